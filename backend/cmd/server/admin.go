@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/game"
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/storage"
+)
+
+type loopStatus struct {
+	Running            bool    `json:"running"`
+	Paused             bool    `json:"paused"`
+	Tick               int64   `json:"tick"`
+	TickIntervalMS     int64   `json:"tickIntervalMs"`
+	TicksPerSecond     float64 `json:"ticksPerSecond"`
+	Overruns           int64   `json:"overruns"`
+	LastTickDurationMS float64 `json:"lastTickDurationMs"`
+}
+
+func (s *server) handleAdminLoop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.loopStatus())
+}
+
+func (s *server) handleAdminLoopAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	switch action := r.PathValue("action"); action {
+	case "pause":
+		s.runner.Pause()
+		log.Printf("admin paused the game loop")
+	case "resume":
+		s.runner.Resume()
+		log.Printf("admin resumed the game loop")
+	case "step":
+		if _, err := s.runner.StepOnce(); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+	case "interval":
+		var req struct {
+			TickIntervalMS int64 `json:"tickIntervalMs"`
+		}
+		if err := readJSONBody(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		interval := time.Duration(req.TickIntervalMS) * time.Millisecond
+		if err := s.runner.SetTickInterval(interval); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		log.Printf("admin set the tick interval to %s", interval)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("unknown loop action "+action))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.loopStatus())
+}
+
+func (s *server) loopStatus() loopStatus {
+	stats := s.runner.Stats()
+	return loopStatus{
+		Running:            stats.Running,
+		Paused:             stats.Paused,
+		Tick:               stats.Tick,
+		TickIntervalMS:     stats.TickInterval.Milliseconds(),
+		TicksPerSecond:     stats.TicksPerSecond,
+		Overruns:           stats.Overruns,
+		LastTickDurationMS: float64(stats.LastTickDuration.Microseconds()) / 1000,
+	}
+}
+
+const (
+	matchConfigKey        = "next-match"
+	maxAnnouncementLength = 500
+)
+
+// matchConfig is applied when the next match starts, either on startup
+// without a checkpoint or when an admin resets the map.
+type matchConfig struct {
+	Width          int   `json:"width"`
+	Height         int   `json:"height"`
+	ResourceBases  int   `json:"resourceBases"`
+	TickIntervalMS int64 `json:"tickIntervalMs"`
+	// Rules adds the teams, win conditions, ownership and supply rules.
+	game.Rules
+}
+
+func (c matchConfig) validate() error {
+	switch {
+	case c.Width < 4 || c.Height < 4 || c.Width > 512 || c.Height > 512:
+		return errors.New("width and height must be between 4 and 512")
+	case c.ResourceBases < 0 || c.ResourceBases > c.Width*c.Height/2:
+		return errors.New("resourceBases must be between 0 and half the board")
+	case time.Duration(c.TickIntervalMS)*time.Millisecond < game.MinTickInterval:
+		return fmt.Errorf("tickIntervalMs must be at least %d", game.MinTickInterval.Milliseconds())
+	case c.WinTerritoryPercent < 0 || c.WinTerritoryPercent > 100:
+		return errors.New("winTerritoryPercent must be between 0 and 100")
+	case c.WinResources < 0:
+		return errors.New("winResources must not be negative")
+	case c.SupplyGraceTicks < 0:
+		return errors.New("supplyGraceTicks must not be negative")
+	case c.Influence != nil && (c.Influence.Decay < 0 || c.Influence.Decay >= 1 || c.Influence.Margin < 0):
+		return errors.New("influence decay must be at least 0 and below 1, and its margin must not be negative")
+	case c.Influence != nil && c.SpreadRule != "" && c.SpreadRule != game.SpreadInfluence:
+		return errors.New("influence settings need the influence spread rule")
+	}
+	if _, err := game.NewSpreadResolver(c.Rules); err != nil {
+		return fmt.Errorf("spreadRule must be one of %s", strings.Join(game.SpreadRules, ", "))
+	}
+	for playerID, team := range c.Teams {
+		if playerID == "" || team == "" || len(team) > maxTeamNameLength {
+			return fmt.Errorf("teams need a player id and a name of at most %d characters", maxTeamNameLength)
+		}
+	}
+	return nil
+}
+
+func loadMatchConfig(ctx context.Context, store storage.Store, defaults matchConfig) (matchConfig, error) {
+	cfg := defaults
+	err := storage.GetJSON(ctx, store, storage.CollectionSettings, matchConfigKey, &cfg)
+	if errors.Is(err, storage.ErrNotFound) {
+		return defaults, nil
+	}
+	return cfg, err
+}
+
+type adminPlayer struct {
+	game.Player
+	Connections    int        `json:"connections"`
+	Connected      bool       `json:"connected"`
+	DisconnectedAt *time.Time `json:"disconnectedAt,omitempty"`
+}
+
+func (s *server) handleAdminPlayers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	snapshot := s.game.CurrentSnapshot()
+	players := make([]adminPlayer, 0, len(snapshot.Players))
+	for _, player := range snapshot.Players {
+		conns, disconnectedAt := s.sessions.status(player.ID)
+		entry := adminPlayer{Player: player, Connections: conns, Connected: conns > 0}
+		if !entry.Connected && !disconnectedAt.IsZero() {
+			entry.DisconnectedAt = &disconnectedAt
+		}
+		players = append(players, entry)
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].ID < players[j].ID })
+
+	writeJSON(w, http.StatusOK, players)
+}
+
+func (s *server) handleAdminKick(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := readJSONBody(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	playerID := r.PathValue("id")
+	if !s.kickPlayer(playerID, orDefault(req.Reason, "kicked by an admin")) {
+		writeError(w, http.StatusNotFound, game.ErrUnknownPlayer)
+		return
+	}
+	log.Printf("admin kicked player %s", playerID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) handleAdminBan(w http.ResponseWriter, r *http.Request) {
+	playerID := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodPut:
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if err := readJSONBody(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		b := ban{PlayerID: playerID, Reason: req.Reason, BannedAt: time.Now().UTC()}
+		if err := s.bans.add(r.Context(), b); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		s.kickPlayer(playerID, orDefault(req.Reason, "banned by an admin"))
+		log.Printf("admin banned player %s", playerID)
+		writeJSON(w, http.StatusOK, b)
+	case http.MethodDelete:
+		removed, err := s.bans.remove(r.Context(), playerID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !removed {
+			writeError(w, http.StatusNotFound, errors.New("player is not banned"))
+			return
+		}
+		log.Printf("admin unbanned player %s", playerID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (s *server) handleAdminBans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.bans.list())
+}
+
+func (s *server) handleAdminMatchConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.nextMatchMu.Lock()
+		cfg := s.nextMatch
+		s.nextMatchMu.Unlock()
+		writeJSON(w, http.StatusOK, cfg)
+	case http.MethodPut:
+		var cfg matchConfig
+		if err := readJSONBody(r, &cfg); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := cfg.validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := storage.PutJSON(r.Context(), s.store, storage.CollectionSettings, matchConfigKey, cfg); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.nextMatchMu.Lock()
+		s.nextMatch = cfg
+		s.nextMatchMu.Unlock()
+		log.Printf("admin set the next match to %dx%d with %d resource bases at %dms per tick", cfg.Width, cfg.Height, cfg.ResourceBases, cfg.TickIntervalMS)
+		writeJSON(w, http.StatusOK, cfg)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (s *server) handleAdminReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if err := s.resetMatch(r.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.game.CurrentSnapshot())
+}
+
+func (s *server) handleAdminTile(w http.ResponseWriter, r *http.Request) {
+	x, errX := strconv.Atoi(r.PathValue("x"))
+	y, errY := strconv.Atoi(r.PathValue("y"))
+	if errX != nil || errY != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid tile position"))
+		return
+	}
+	pos := game.Position{X: x, Y: y}
+
+	var err error
+	switch kind := r.PathValue("kind"); {
+	case kind == "core" && r.Method == http.MethodPut:
+		var req struct {
+			PlayerID string `json:"playerId"`
+		}
+		if err := readJSONBody(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		err = s.game.PlaceCore(req.PlayerID, pos)
+	case kind == "core" && r.Method == http.MethodDelete:
+		err = s.game.RemoveCore(pos)
+	case kind == "resource-base" && r.Method == http.MethodPut:
+		err = s.game.PlaceResourceBase(pos)
+	case kind == "resource-base" && r.Method == http.MethodDelete:
+		err = s.game.RemoveResourceBase(pos)
+	case kind == "core" || kind == "resource-base":
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	default:
+		writeError(w, http.StatusNotFound, errors.New("unknown tile kind "+kind))
+		return
+	}
+
+	switch {
+	case errors.Is(err, game.ErrUnknownPlayer):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, game.ErrOutOfBounds):
+		writeError(w, http.StatusBadRequest, err)
+	case err != nil:
+		writeError(w, http.StatusConflict, err)
+	default:
+		log.Printf("admin %s %s at %d,%d", r.Method, r.PathValue("kind"), x, y)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *server) handleAdminAnnounce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	var req struct {
+		Message string `json:"message"`
+	}
+	if err := readJSONBody(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	message := strings.TrimSpace(req.Message)
+	if message == "" || len(message) > maxAnnouncementLength {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("message must be 1 to %d characters", maxAnnouncementLength))
+		return
+	}
+
+	delivered := 0
+	for _, client := range s.connectedClients(true) {
+		if client.enqueue(wsMessage{Type: "announcement", Message: message}) {
+			delivered++
+		}
+	}
+	log.Printf("admin announcement delivered to %d client(s): %s", delivered, message)
+	writeJSON(w, http.StatusOK, map[string]int{"delivered": delivered})
+}
+
+// kickPlayer disconnects the player and removes them from the game. The
+// player may join again unless they are also banned.
+func (s *server) kickPlayer(playerID, reason string) bool {
+	s.sessions.drop(playerID)
+
+	for _, client := range s.connectedClients(false) {
+		if client.playerID == playerID {
+			client.enqueue(wsMessage{Type: "kicked", Message: reason})
+			client.close(websocket.ClosePolicyViolation, reason)
+		}
+	}
+
+	return s.game.RemovePlayer(playerID)
+}
+
+// resetMatch saves the current match and starts a new one with the next
+// match config. Connected players rejoin the new board right away.
+func (s *server) resetMatch(ctx context.Context) error {
+	if err := s.saveReplay(ctx); err != nil {
+		log.Printf("failed to save replay before reset: %v", err)
+	}
+
+	s.nextMatchMu.Lock()
+	cfg := s.nextMatch
+	s.nextMatchMu.Unlock()
+
+	// The rules are applied together with the new board, so the runner never
+	// ticks it under the old ones and a bad config leaves the match alone.
+	if err := s.game.Reset(cfg.Width, cfg.Height, cfg.ResourceBases, time.Now().UnixNano(), cfg.Rules); err != nil {
+		return err
+	}
+	if err := s.runner.SetTickInterval(time.Duration(cfg.TickIntervalMS) * time.Millisecond); err != nil {
+		log.Printf("failed to set the tick interval of the new match: %v", err)
+	}
+	s.clearMarkers(ctx)
+	s.alliances.clear()
+	s.proposals.clear()
+	if err := s.startRecording(); err != nil {
+		log.Printf("failed to start recording the new match: %v", err)
+	}
+
+	for _, client := range s.connectedClients(false) {
+		player, err := s.joinGame(client.playerID)
+		if err != nil {
+			log.Printf("failed to add %s to the new match: %v", client.playerID, err)
+			continue
+		}
+		client.enqueue(wsMessage{Type: "reset", Player: player, Snapshot: ptrSnapshot(s.game.CurrentSnapshot())})
+	}
+
+	if err := s.writeCheckpoint(ctx); err != nil {
+		log.Printf("failed to write checkpoint after reset: %v", err)
+	}
+	log.Printf("admin started a new %dx%d match", cfg.Width, cfg.Height)
+	return nil
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/game"
+)
+
+const maxTeamNameLength = 24
+
+var (
+	errNoAllianceRequest = errors.New("no pending alliance request from that player")
+	errAlreadyAllied     = errors.New("you are already allied")
+	errAllySelf          = errors.New("you cannot ally with yourself")
+)
+
+type allianceRequest struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// allianceKey names the request of one player to another.
+type allianceKey struct {
+	from, to string
+}
+
+// teamOf is the team hook of chat and pings.
+func (s *server) teamOf(playerID string) string {
+	if player, ok := s.game.Player(playerID); ok {
+		return player.Team
+	}
+	return ""
+}
+
+// handleAllianceRequest asks another player to join the sender's team, e.g.
+// {"type":"allianceRequest","playerId":"player-2"}.
+func (s *server) handleAllianceRequest(client *wsClient, message wsIncoming) {
+	err := func() error {
+		switch {
+		case message.PlayerID == client.playerID:
+			return errAllySelf
+		case s.game.Rules().FixedTeams:
+			return game.ErrTeamsFixed
+		}
+		if _, ok := s.game.Player(message.PlayerID); !ok {
+			return game.ErrUnknownPlayer
+		}
+		if s.game.Allied(client.playerID, message.PlayerID) {
+			return errAlreadyAllied
+		}
+		return nil
+	}()
+	if err != nil {
+		client.enqueue(wsMessage{Type: "allianceError", Message: err.Error()})
+		return
+	}
+
+	req := s.alliances.add(allianceKey{from: client.playerID, to: message.PlayerID}, func(expiresAt time.Time) allianceRequest {
+		return allianceRequest{From: client.playerID, To: message.PlayerID, ExpiresAt: expiresAt}
+	})
+	s.sendToPlayer(req.From, wsMessage{Type: "allianceRequest", Alliance: &req})
+	s.sendToPlayer(req.To, wsMessage{Type: "allianceRequest", Alliance: &req})
+}
+
+// handleAllianceAnswer accepts or declines the request of the player named
+// in playerId. Accepting joins the requester's team; a requester without a
+// team founds one named after their display name.
+func (s *server) handleAllianceAnswer(client *wsClient, message wsIncoming, accept bool) {
+	req, ok := s.alliances.take(allianceKey{from: message.PlayerID, to: client.playerID})
+	if !ok {
+		client.enqueue(wsMessage{Type: "allianceError", Message: errNoAllianceRequest.Error()})
+		return
+	}
+	if !accept {
+		s.sendToPlayer(req.From, wsMessage{Type: "allianceDeclined", Alliance: &req})
+		s.sendToPlayer(req.To, wsMessage{Type: "allianceDeclined", Alliance: &req})
+		return
+	}
+
+	err := func() error {
+		requester, ok := s.game.Player(req.From)
+		if !ok {
+			return game.ErrUnknownPlayer
+		}
+		team := requester.Team
+		if team == "" {
+			var err error
+			if team, err = s.game.FoundTeam(requester.ID, teamName(requester.DisplayName)); err != nil {
+				return err
+			}
+		}
+		return s.game.SetTeam(req.To, team)
+	}()
+	if err != nil {
+		client.enqueue(wsMessage{Type: "allianceError", Message: err.Error()})
+		return
+	}
+	s.sendToPlayer(req.From, wsMessage{Type: "allianceAccepted", Alliance: &req})
+	s.sendToPlayer(req.To, wsMessage{Type: "allianceAccepted", Alliance: &req})
+}
+
+// teamName shortens a display name to a team name, leaving room for the
+// number FoundTeam adds when the name is taken.
+func teamName(displayName string) string {
+	name := []rune(strings.TrimSpace(displayName))
+	if limit := maxTeamNameLength - 4; len(name) > limit {
+		name = name[:limit]
+	}
+	return strings.TrimSpace(string(name))
+}
+
+// handleLeaveTeam takes the sender out of their team.
+func (s *server) handleLeaveTeam(client *wsClient) {
+	if err := s.game.SetTeam(client.playerID, ""); err != nil {
+		client.enqueue(wsMessage{Type: "allianceError", Message: err.Error()})
+	}
+}
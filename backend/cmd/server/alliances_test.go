@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestTeamName(t *testing.T) {
+	cases := map[string]string{
+		"  Ada  ":                         "Ada",
+		"":                                "",
+		"A very long display name indeed": "A very long display",
+	}
+	for displayName, want := range cases {
+		if got := teamName(displayName); got != want {
+			t.Errorf("teamName(%q) = %q, want %q", displayName, got, want)
+		}
+	}
+}
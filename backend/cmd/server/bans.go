@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/storage"
+)
+
+var errPlayerBanned = errors.New("player is banned")
+
+type ban struct {
+	PlayerID string    `json:"playerId"`
+	Reason   string    `json:"reason,omitempty"`
+	BannedAt time.Time `json:"bannedAt"`
+}
+
+// banList keeps the bans in memory for the auth middleware and writes every
+// change through to the store so bans survive a restart.
+type banList struct {
+	mu    sync.RWMutex
+	store storage.Store
+	bans  map[string]ban
+}
+
+func loadBans(ctx context.Context, store storage.Store) (*banList, error) {
+	ids, err := store.List(ctx, storage.CollectionBans)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &banList{store: store, bans: make(map[string]ban, len(ids))}
+	for _, id := range ids {
+		var b ban
+		if err := storage.GetJSON(ctx, store, storage.CollectionBans, id, &b); err != nil {
+			return nil, err
+		}
+		list.bans[id] = b
+	}
+	return list, nil
+}
+
+func (l *banList) has(playerID string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	_, ok := l.bans[playerID]
+	return ok
+}
+
+func (l *banList) add(ctx context.Context, b ban) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := storage.PutJSON(ctx, l.store, storage.CollectionBans, b.PlayerID, b); err != nil {
+		return err
+	}
+	l.bans[b.PlayerID] = b
+	return nil
+}
+
+// remove lifts a ban. It reports false when the player was not banned.
+func (l *banList) remove(ctx context.Context, playerID string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.bans[playerID]; !ok {
+		return false, nil
+	}
+	if err := l.store.Delete(ctx, storage.CollectionBans, playerID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return false, err
+	}
+	delete(l.bans, playerID)
+	return true, nil
+}
+
+func (l *banList) list() []ban {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	bans := make([]ban, 0, len(l.bans))
+	for _, b := range l.bans {
+		bans = append(bans, b)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].PlayerID < bans[j].PlayerID })
+	return bans
+}
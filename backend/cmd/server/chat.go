@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/chat"
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/game"
+)
+
+func loadChatConfig() chat.Config {
+	return chat.Config{
+		HistorySize: getEnvInt("CHAT_HISTORY_SIZE", chat.DefaultConfig.HistorySize),
+		MaxLength:   getEnvInt("CHAT_MAX_LENGTH", chat.DefaultConfig.MaxLength),
+		RateLimit:   getEnvInt("CHAT_RATE_LIMIT", chat.DefaultConfig.RateLimit),
+		RateWindow:  time.Duration(getEnvInt("CHAT_RATE_WINDOW_MS", int(chat.DefaultConfig.RateWindow.Milliseconds()))) * time.Millisecond,
+		DefaultMute: time.Duration(getEnvInt("CHAT_DEFAULT_MUTE_MS", int(chat.DefaultConfig.DefaultMute.Milliseconds()))) * time.Millisecond,
+		MaxMute:     time.Duration(getEnvInt("CHAT_MAX_MUTE_MS", int(chat.DefaultConfig.MaxMute.Milliseconds()))) * time.Millisecond,
+	}
+}
+
+// handleChat posts a chat message, e.g.
+// {"type":"chat","channel":"direct","to":"player-2","text":"hi"}, and sends
+// it to everyone who may read it. Errors only go back to the sender.
+func (s *server) handleChat(client *wsClient, message wsIncoming) {
+	if message.Channel == chat.ChannelDirect {
+		if _, ok := s.game.Player(message.To); !ok {
+			client.enqueue(wsMessage{Type: "chatError", Message: game.ErrUnknownPlayer.Error()})
+			return
+		}
+	}
+
+	name := ""
+	if p, ok := s.profiles.Get(client.playerID); ok {
+		name = p.DisplayName
+	}
+	posted, err := s.chat.Post(client.playerID, name, message.Channel, message.To, message.Text)
+	if err != nil {
+		client.enqueue(wsMessage{Type: "chatError", Message: err.Error()})
+		return
+	}
+	s.deliverChat(wsMessage{Type: "chat", Chat: &posted})
+}
+
+// deliverChat sends a chat message or deletion to every player who may read
+// the message.
+func (s *server) deliverChat(message wsMessage) {
+	for _, client := range s.connectedClients(false) {
+		if s.chat.VisibleTo(*message.Chat, client.playerID) {
+			client.enqueue(message)
+		}
+	}
+}
+
+func (s *server) handleAdminMute(w http.ResponseWriter, r *http.Request) {
+	playerID := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodPut:
+		var req struct {
+			DurationMS int64  `json:"durationMs"`
+			Reason     string `json:"reason"`
+		}
+		if err := readJSONBody(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		// Durations this long would overflow time.Duration; they are far
+		// beyond any MaxMute anyway.
+		if req.DurationMS > math.MaxInt64/int64(time.Millisecond) {
+			writeError(w, http.StatusBadRequest, chat.ErrMuteTooLong)
+			return
+		}
+		until, err := s.chat.Mute(playerID, time.Duration(req.DurationMS)*time.Millisecond)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		for _, client := range s.connectedClients(false) {
+			if client.playerID == playerID {
+				client.enqueue(wsMessage{Type: "muted", Message: orDefault(req.Reason, "muted by a moderator"), ExpiresAt: &until})
+			}
+		}
+		log.Printf("moderator muted player %s until %s", playerID, until.Format(time.RFC3339))
+		writeJSON(w, http.StatusOK, map[string]interface{}{"playerId": playerID, "mutedUntil": until})
+	case http.MethodDelete:
+		if !s.chat.Unmute(playerID) {
+			writeError(w, http.StatusNotFound, errors.New("player is not muted"))
+			return
+		}
+		log.Printf("moderator unmuted player %s", playerID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (s *server) handleAdminChatDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	deleted, ok := s.chat.Delete(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown chat message"))
+		return
+	}
+	s.deliverChat(wsMessage{Type: "chatDeleted", Chat: &deleted})
+	log.Printf("moderator deleted chat message %s by %s", deleted.ID, deleted.From)
+	w.WriteHeader(http.StatusNoContent)
+}
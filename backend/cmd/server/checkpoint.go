@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/game"
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/storage"
+)
+
+const latestCheckpointKey = "latest"
+
+// loadCheckpoint restores the game from the latest checkpoint in the store.
+// It returns (nil, nil) when there is no checkpoint to restore from.
+func loadCheckpoint(ctx context.Context, store storage.Store) (*game.Game, error) {
+	data, err := store.Get(ctx, storage.CollectionCheckpoints, latestCheckpointKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := game.Load(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("load checkpoint: %w", err)
+	}
+	return g, nil
+}
+
+func (s *server) writeCheckpoint(ctx context.Context) error {
+	var buf bytes.Buffer
+	if err := s.game.Save(&buf); err != nil {
+		return fmt.Errorf("save game: %w", err)
+	}
+	return s.store.Put(ctx, storage.CollectionCheckpoints, latestCheckpointKey, buf.Bytes())
+}
+
+// startRecording begins recording a new match when replays are enabled.
+func (s *server) startRecording() error {
+	if !s.recordReplays {
+		return nil
+	}
+	matchID := newMatchID()
+	if err := s.game.StartRecording(matchID); err != nil {
+		return err
+	}
+	log.Printf("recording replay %s", matchID)
+	return nil
+}
+
+// rotateReplay saves the recording so far and continues the match in a new
+// one, which keeps the recording held in memory bounded.
+func (s *server) rotateReplay(ctx context.Context) error {
+	matchID := newMatchID()
+	finished, err := s.game.RotateRecording(matchID)
+	if errors.Is(err, game.ErrNotRecording) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("recording replay %s, continuing %s", matchID, finished.ID)
+	return s.putReplay(ctx, finished)
+}
+
+// saveReplay persists the recording of the current match, if any.
+func (s *server) saveReplay(ctx context.Context) error {
+	log, err := s.game.Recording()
+	if errors.Is(err, game.ErrNotRecording) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.putReplay(ctx, log)
+}
+
+// putReplay stores the recording and its summary. The summary is written
+// last, so a listed replay can always be loaded.
+func (s *server) putReplay(ctx context.Context, l game.ReplayLog) error {
+	if err := storage.PutJSON(ctx, s.store, storage.CollectionMatches, l.ID, l); err != nil {
+		return err
+	}
+	return storage.PutJSON(ctx, s.store, storage.CollectionMatchSummaries, l.ID, summarizeReplay(l))
+}
+
+func newMatchID() string {
+	return "match-" + time.Now().UTC().Format("20060102T150405.000Z")
+}
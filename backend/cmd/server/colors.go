@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/game"
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/profile"
+)
+
+var errColorNotOffered = errors.New("color is not in any of the offered palettes")
+
+// colorConfig is which palettes players may pick their color from and which
+// one new players are assigned a color from.
+type colorConfig struct {
+	Palettes         []game.Palette `json:"palettes"`
+	Assigned         string         `json:"assignedPalette"`
+	MinColorDistance float64        `json:"minColorDistance"`
+}
+
+// loadColorConfig reads the palette settings. GAME_PALETTES is either a
+// comma separated list of built-in palette names or a JSON array of
+// game.Palette objects, and defaults to every built-in palette.
+// GAME_PALETTE picks the palette colors are assigned from and defaults to the
+// first offered one.
+func loadColorConfig() (colorConfig, error) {
+	cfg := colorConfig{MinColorDistance: float64(getEnvInt("GAME_MIN_COLOR_DISTANCE", game.DefaultMinColorDistance))}
+
+	raw := strings.TrimSpace(os.Getenv("GAME_PALETTES"))
+	switch {
+	case strings.HasPrefix(raw, "["):
+		if err := json.Unmarshal([]byte(raw), &cfg.Palettes); err != nil {
+			return colorConfig{}, fmt.Errorf("GAME_PALETTES: %w", err)
+		}
+	case raw != "":
+		for _, name := range splitList(raw) {
+			palette, ok := game.FindPalette(name)
+			if !ok {
+				return colorConfig{}, fmt.Errorf("GAME_PALETTES: unknown palette %q", name)
+			}
+			cfg.Palettes = append(cfg.Palettes, palette)
+		}
+	default:
+		cfg.Palettes = append(cfg.Palettes, game.Palettes...)
+	}
+	if len(cfg.Palettes) == 0 {
+		return colorConfig{}, errors.New("GAME_PALETTES: no palettes")
+	}
+
+	for i, palette := range cfg.Palettes {
+		if palette.Name == "" || len(palette.Colors) == 0 {
+			return colorConfig{}, fmt.Errorf("GAME_PALETTES: palette %d needs a name and colors", i)
+		}
+		colors := make([]string, 0, len(palette.Colors))
+		for _, color := range palette.Colors {
+			normalized, err := profile.NormalizeColor(color)
+			if err != nil {
+				return colorConfig{}, fmt.Errorf("GAME_PALETTES: palette %s: %w", palette.Name, err)
+			}
+			colors = append(colors, normalized)
+		}
+		cfg.Palettes[i].Colors = colors
+	}
+
+	cfg.Assigned = getEnv("GAME_PALETTE", cfg.Palettes[0].Name)
+	if _, ok := cfg.palette(cfg.Assigned); !ok {
+		return colorConfig{}, fmt.Errorf("GAME_PALETTE: %q is not offered", cfg.Assigned)
+	}
+	return cfg, nil
+}
+
+func (c colorConfig) palette(name string) (game.Palette, bool) {
+	for _, p := range c.Palettes {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return game.Palette{}, false
+}
+
+// offers reports whether color is in one of the palettes.
+func (c colorConfig) offers(color string) bool {
+	for _, p := range c.Palettes {
+		for _, offered := range p.Colors {
+			if strings.EqualFold(offered, color) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// apply makes g assign colors from the assigned palette and keep them apart.
+func (c colorConfig) apply(g *game.Game) error {
+	assigned, _ := c.palette(c.Assigned)
+	return g.SetColorRules(assigned.Colors, c.MinColorDistance)
+}
+
+func (s *server) handlePalettes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.colors)
+}
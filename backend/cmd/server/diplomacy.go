@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/game"
+)
+
+var errNoProposal = errors.New("no pending proposal of that kind from that player")
+
+type diplomacyConfig struct {
+	ProposalTTL  time.Duration
+	DefaultTicks int64
+	MaxTicks     int64
+	BreakPenalty int
+}
+
+func loadDiplomacyConfig() diplomacyConfig {
+	return diplomacyConfig{
+		ProposalTTL:  time.Duration(getEnvInt("DIPLOMACY_PROPOSAL_TTL_MS", 60000)) * time.Millisecond,
+		DefaultTicks: int64(getEnvInt("DIPLOMACY_DEFAULT_TICKS", 120)),
+		MaxTicks:     int64(getEnvInt("DIPLOMACY_MAX_TICKS", 600)),
+		BreakPenalty: getEnvInt("DIPLOMACY_BREAK_PENALTY", 10),
+	}
+}
+
+type agreementProposal struct {
+	From      string             `json:"from"`
+	To        string             `json:"to"`
+	Kind      game.AgreementKind `json:"kind"`
+	Ticks     int64              `json:"ticks"`
+	ExpiresAt time.Time          `json:"expiresAt"`
+}
+
+// proposalKey names the proposal of one kind of agreement from one player to
+// another.
+type proposalKey struct {
+	from, to string
+	kind     game.AgreementKind
+}
+
+// proposalTicks is how long a proposed agreement lasts: the default duration
+// when none was asked for, and at most the configured maximum.
+func (c diplomacyConfig) proposalTicks(ticks int64) int64 {
+	if ticks <= 0 {
+		ticks = c.DefaultTicks
+	}
+	return min(ticks, c.MaxTicks)
+}
+
+// handleProposeAgreement offers another player an agreement, e.g.
+// {"type":"proposeAgreement","playerId":"player-2","kind":"truce","ticks":60}.
+// Without ticks the default duration is used.
+func (s *server) handleProposeAgreement(client *wsClient, message wsIncoming) {
+	kind := game.AgreementKind(message.Kind)
+	err := func() error {
+		switch {
+		case message.PlayerID == client.playerID:
+			return game.ErrInvalidAgreement
+		case kind != game.AgreementTruce && kind != game.AgreementNonAggression:
+			return game.ErrUnknownAgreementKind
+		}
+		if _, ok := s.game.Player(message.PlayerID); !ok {
+			return game.ErrUnknownPlayer
+		}
+		for _, agreement := range s.game.Agreements() {
+			if agreement.Kind == kind && agreement.Players == sortedPair(client.playerID, message.PlayerID) {
+				return game.ErrAgreementExists
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		client.enqueue(wsMessage{Type: "agreementError", Message: err.Error()})
+		return
+	}
+
+	key := proposalKey{from: client.playerID, to: message.PlayerID, kind: kind}
+	proposal := s.proposals.add(key, func(expiresAt time.Time) agreementProposal {
+		return agreementProposal{
+			From:      client.playerID,
+			To:        message.PlayerID,
+			Kind:      kind,
+			Ticks:     s.diplomacy.proposalTicks(message.Ticks),
+			ExpiresAt: expiresAt,
+		}
+	})
+	s.sendToPlayer(proposal.From, wsMessage{Type: "agreementProposed", Proposal: &proposal})
+	s.sendToPlayer(proposal.To, wsMessage{Type: "agreementProposed", Proposal: &proposal})
+}
+
+// handleAgreementAnswer accepts or declines the proposal of the given kind
+// from the player named in playerId.
+func (s *server) handleAgreementAnswer(client *wsClient, message wsIncoming, accept bool) {
+	proposal, ok := s.proposals.take(proposalKey{from: message.PlayerID, to: client.playerID, kind: game.AgreementKind(message.Kind)})
+	if !ok {
+		client.enqueue(wsMessage{Type: "agreementError", Message: errNoProposal.Error()})
+		return
+	}
+	if !accept {
+		s.sendToPlayer(proposal.From, wsMessage{Type: "agreementDeclined", Proposal: &proposal})
+		s.sendToPlayer(proposal.To, wsMessage{Type: "agreementDeclined", Proposal: &proposal})
+		return
+	}
+
+	agreement, err := s.game.MakeAgreement(proposal.Kind, proposal.From, proposal.To, proposal.Ticks, s.diplomacy.BreakPenalty)
+	if err != nil {
+		client.enqueue(wsMessage{Type: "agreementError", Message: err.Error()})
+		return
+	}
+	s.sendToPlayer(proposal.From, wsMessage{Type: "agreementAccepted", Agreement: &agreement})
+	s.sendToPlayer(proposal.To, wsMessage{Type: "agreementAccepted", Agreement: &agreement})
+}
+
+// handleBreakAgreement ends one of the sender's agreements early, e.g.
+// {"type":"breakAgreement","id":"a3"}, at the cost of the penalty.
+func (s *server) handleBreakAgreement(client *wsClient, message wsIncoming) {
+	agreement, err := s.game.BreakAgreement(message.ID, client.playerID)
+	if err != nil {
+		client.enqueue(wsMessage{Type: "agreementError", Message: err.Error()})
+		return
+	}
+	for _, playerID := range agreement.Players {
+		s.sendToPlayer(playerID, wsMessage{Type: "agreementBroken", Agreement: &agreement})
+	}
+}
+
+func sortedPair(a, b string) [2]string {
+	if b < a {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
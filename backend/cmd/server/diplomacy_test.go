@@ -0,0 +1,12 @@
+package main
+
+import "testing"
+
+func TestProposalTicks(t *testing.T) {
+	config := diplomacyConfig{DefaultTicks: 10, MaxTicks: 20}
+	for ticks, want := range map[int64]int64{0: 10, -5: 10, 15: 15, 50: 20} {
+		if got := config.proposalTicks(ticks); got != want {
+			t.Errorf("proposalTicks(%d) = %d, want %d", ticks, got, want)
+		}
+	}
+}
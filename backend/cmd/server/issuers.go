@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/auth"
+)
+
+// loadIssuerConfigs collects the trusted token issuers. AUTH_ISSUERS is
+// either a comma separated list of issuer URLs sharing AUTH_AUDIENCE and
+// AUTH_SUBJECT_CLAIM, or a JSON array of auth.IssuerConfig objects for
+// per-issuer settings. The COGNITO_* variables add a Cognito user pool, and
+// the dev issuer is trusted when it is enabled. Every issuer needs an
+// audience: without one, tokens the issuer minted for other applications
+// would be accepted as well.
+func loadIssuerConfigs(devIssuer *auth.DevIssuer) ([]auth.IssuerConfig, error) {
+	var issuers []auth.IssuerConfig
+	if devIssuer != nil {
+		issuers = append(issuers, devIssuer.Config())
+	}
+
+	raw := strings.TrimSpace(os.Getenv("AUTH_ISSUERS"))
+	if strings.HasPrefix(raw, "[") {
+		var configured []auth.IssuerConfig
+		if err := json.Unmarshal([]byte(raw), &configured); err != nil {
+			return nil, fmt.Errorf("AUTH_ISSUERS: %w", err)
+		}
+		issuers = append(issuers, configured...)
+	} else {
+		for _, issuerURL := range splitList(raw) {
+			issuers = append(issuers, auth.IssuerConfig{
+				Issuer:       issuerURL,
+				Audiences:    splitList(os.Getenv("AUTH_AUDIENCE")),
+				SubjectClaim: os.Getenv("AUTH_SUBJECT_CLAIM"),
+			})
+		}
+	}
+
+	region := os.Getenv("COGNITO_REGION")
+	userPoolID := os.Getenv("COGNITO_USER_POOL_ID")
+	if region != "" && userPoolID != "" {
+		issuers = append(issuers, auth.Cognito(region, userPoolID, os.Getenv("COGNITO_APP_CLIENT_ID")))
+	}
+
+	if len(issuers) == 0 {
+		return nil, errors.New("set AUTH_ISSUERS or COGNITO_REGION and COGNITO_USER_POOL_ID, or AUTH_DEV_ISSUER=true")
+	}
+	for _, issuer := range issuers {
+		if len(issuer.Audiences) == 0 {
+			return nil, fmt.Errorf("issuer %s has no audience: set AUTH_AUDIENCE, audiences in AUTH_ISSUERS or COGNITO_APP_CLIENT_ID", issuer.Issuer)
+		}
+	}
+	return issuers, nil
+}
+
+// loadDevIssuer starts the local token issuer when AUTH_DEV_ISSUER is set.
+// ALLOW_INSECURE_AUTH used to switch authentication off entirely and is now
+// an alias, so existing development setups keep working with real tokens.
+func loadDevIssuer(logger *log.Logger, port string) (*auth.DevIssuer, error) {
+	enabled := strings.EqualFold(os.Getenv("AUTH_DEV_ISSUER"), "true")
+	if strings.EqualFold(os.Getenv("ALLOW_INSECURE_AUTH"), "true") {
+		logger.Printf("ALLOW_INSECURE_AUTH is deprecated, use AUTH_DEV_ISSUER=true; enabling the dev issuer")
+		enabled = true
+	}
+	if !enabled {
+		return nil, nil
+	}
+	return auth.NewDevIssuer(getEnv("AUTH_DEV_ISSUER_URL", "http://localhost:"+port+"/dev"))
+}
+
+// devIssuerPath is where the dev issuer's endpoints are served: the path of
+// its issuer URL, so that discovery works for other services as well.
+func devIssuerPath(devIssuer *auth.DevIssuer) string {
+	path := "/dev"
+	if u, err := url.Parse(devIssuer.Config().Issuer); err == nil && u.Path != "" && u.Path != "/" {
+		path = strings.TrimSuffix(u.Path, "/")
+	}
+	return path
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadIssuerConfigsRequiresAudiences(t *testing.T) {
+	cases := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{"issuer list with audience", map[string]string{"AUTH_ISSUERS": "https://a.test/", "AUTH_AUDIENCE": "spheres"}, ""},
+		{"issuer list without audience", map[string]string{"AUTH_ISSUERS": "https://a.test/"}, "https://a.test/"},
+		{"json issuer without audience", map[string]string{"AUTH_ISSUERS": `[{"issuer":"https://b.test/","audiences":["spheres"]},{"issuer":"https://c.test/"}]`}, "https://c.test/"},
+		{"cognito without client id", map[string]string{"COGNITO_REGION": "eu-west-1", "COGNITO_USER_POOL_ID": "pool"}, "cognito-idp"},
+		{"cognito with client id", map[string]string{"COGNITO_REGION": "eu-west-1", "COGNITO_USER_POOL_ID": "pool", "COGNITO_APP_CLIENT_ID": "client"}, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for _, key := range []string{"AUTH_ISSUERS", "AUTH_AUDIENCE", "AUTH_SUBJECT_CLAIM", "COGNITO_REGION", "COGNITO_USER_POOL_ID", "COGNITO_APP_CLIENT_ID"} {
+				t.Setenv(key, c.env[key])
+			}
+
+			_, err := loadIssuerConfigs(nil)
+			switch {
+			case c.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case c.wantErr != "" && (err == nil || !strings.Contains(err.Error(), c.wantErr)):
+				t.Fatalf("expected an error naming %s, got %v", c.wantErr, err)
+			}
+		})
+	}
+}
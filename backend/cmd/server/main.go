@@ -2,19 +2,29 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
 
 	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/auth"
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/chat"
 	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/game"
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/markers"
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/profile"
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/storage"
 )
 
 type contextKey string
@@ -22,20 +32,61 @@ type contextKey string
 const (
 	playerIDContextKey contextKey = "playerID"
 	claimsContextKey   contextKey = "claims"
+	roleContextKey     contextKey = "role"
 )
 
 type server struct {
 	game       *game.Game
+	runner     *game.Runner
+	sessions   *sessionManager
 	validator  *auth.Validator
-	skipAuth   bool
+	roles      auth.RoleMapper
+	devIssuer  *auth.DevIssuer
 	upgrader   websocket.Upgrader
 	corsOrigin string
+	ws         wsConfig
+
+	store           storage.Store
+	checkpointEvery int64
+	adminToken      string
+	recordReplays   bool
+	replaySegment   int
+	bans            *banList
+	profiles        *profile.Registry
+	colors          colorConfig
+	chat            *chat.Hub
+	markers         *markers.Board
+	diplomacy       diplomacyConfig
+	alliances       *pendingRequests[allianceKey, allianceRequest]
+	proposals       *pendingRequests[proposalKey, agreementProposal]
+
+	nextMatchMu sync.Mutex
+	nextMatch   matchConfig
+
+	clientsMu    sync.Mutex
+	clients      map[*wsClient]struct{}
+	clientsWG    sync.WaitGroup
+	shuttingDown bool
 }
 
 type wsMessage struct {
-	Type     string             `json:"type"`
-	Player   *game.Player       `json:"player,omitempty"`
-	Snapshot *game.GameSnapshot `json:"snapshot,omitempty"`
+	Type        string               `json:"type"`
+	Player      *game.Player         `json:"player,omitempty"`
+	Snapshot    *game.GameSnapshot   `json:"snapshot,omitempty"`
+	ResumeToken string               `json:"resumeToken,omitempty"`
+	Deltas      []game.SnapshotDelta `json:"deltas,omitempty"`
+	Message     string               `json:"message,omitempty"`
+	Replay      *replayStatus        `json:"replay,omitempty"`
+	ExpiresAt   *time.Time           `json:"expiresAt,omitempty"`
+	Chat        *chat.Message        `json:"chat,omitempty"`
+	ChatHistory []chat.Message       `json:"chatHistory,omitempty"`
+	Ping        *markers.Ping        `json:"ping,omitempty"`
+	Pings       []markers.Ping       `json:"pings,omitempty"`
+	Marker      *markers.Marker      `json:"marker,omitempty"`
+	Markers     []markers.Marker     `json:"markers,omitempty"`
+	Alliance    *allianceRequest     `json:"alliance,omitempty"`
+	Proposal    *agreementProposal   `json:"proposal,omitempty"`
+	Agreement   *game.Agreement      `json:"agreement,omitempty"`
 }
 
 func main() {
@@ -45,62 +96,245 @@ func main() {
 	height := getEnvInt("GAME_HEIGHT", 64)
 	resourceTiles := getEnvInt("GAME_RESOURCE_TILES", (width*height)/10)
 	tickMS := getEnvInt("GAME_TICK_MS", 1000)
+	historyTicks := getEnvInt("GAME_HISTORY_TICKS", game.DefaultHistoryTicks)
+	disconnectGraceMS := getEnvInt("PLAYER_DISCONNECT_GRACE_MS", 120000)
+	shutdownTimeout := time.Duration(getEnvInt("SHUTDOWN_TIMEOUT_MS", 20000)) * time.Millisecond
 
-	skipAuth := strings.EqualFold(os.Getenv("ALLOW_INSECURE_AUTH"), "true")
-	cognitoRegion := os.Getenv("COGNITO_REGION")
-	userPoolID := os.Getenv("COGNITO_USER_POOL_ID")
-	clientID := os.Getenv("COGNITO_APP_CLIENT_ID")
+	port := getEnv("PORT", "8080")
 
-	var validator *auth.Validator
-	var err error
-	if !skipAuth {
-		validator, err = auth.NewValidator(cognitoRegion, userPoolID, clientID)
-		if err != nil {
-			logger.Fatalf("failed to initialise validator: %v", err)
-		}
-		logger.Printf("Cognito auth enabled (region=%s, userPool=%s)", cognitoRegion, userPoolID)
+	devIssuer, err := loadDevIssuer(logger, port)
+	if err != nil {
+		logger.Fatalf("failed to start dev issuer: %v", err)
+	}
+	issuers, err := loadIssuerConfigs(devIssuer)
+	if err != nil {
+		logger.Fatalf("invalid issuer configuration: %v", err)
+	}
+	validator, err := auth.NewValidator(context.Background(), getEnv("AUTH_ROLE_CLAIM", "groups"), issuers...)
+	if err != nil {
+		logger.Fatalf("failed to initialise validator: %v", err)
+	}
+	validator.SetRefreshPolicy(auth.RefreshPolicy{
+		Interval:    time.Duration(getEnvInt("AUTH_JWKS_REFRESH_MS", 0)) * time.Millisecond,
+		MinInterval: time.Duration(getEnvInt("AUTH_JWKS_MIN_REFRESH_MS", 0)) * time.Millisecond,
+		Retention:   time.Duration(getEnvInt("AUTH_JWKS_RETAIN_MS", 0)) * time.Millisecond,
+	})
+	for _, issuer := range issuers {
+		logger.Printf("trusting tokens from %s", issuer.Issuer)
+	}
+
+	store, err := openStore(getEnv("STORAGE_BACKEND", "file"), os.Getenv("STORAGE_DIR"))
+	if err != nil {
+		logger.Fatalf("failed to open storage: %v", err)
+	}
+
+	bans, err := loadBans(context.Background(), store)
+	if err != nil {
+		logger.Fatalf("failed to load bans: %v", err)
+	}
+
+	profiles, err := profile.Load(context.Background(), store, profile.NewFilter(splitList(os.Getenv("PROFILE_BLOCKED_WORDS"))...))
+	if err != nil {
+		logger.Fatalf("failed to load profiles: %v", err)
+	}
+
+	nextMatch, err := loadMatchConfig(context.Background(), store, matchConfig{
+		Width:          width,
+		Height:         height,
+		ResourceBases:  resourceTiles,
+		TickIntervalMS: int64(tickMS),
+		Rules: game.Rules{
+			WinTerritoryPercent: getEnvInt("GAME_WIN_TERRITORY_PERCENT", 0),
+			WinResources:        getEnvInt("GAME_WIN_RESOURCES", 0),
+			SpreadRule:          getEnv("GAME_SPREAD_RULE", ""),
+			SupplyGraceTicks:    getEnvInt("GAME_SUPPLY_GRACE_TICKS", 0),
+		},
+	})
+	if err != nil {
+		logger.Fatalf("failed to load match config: %v", err)
+	}
+	if err := nextMatch.validate(); err != nil {
+		logger.Fatalf("invalid match config: %v", err)
+	}
+
+	g, err := loadCheckpoint(context.Background(), store)
+	if err != nil {
+		logger.Fatalf("failed to restore checkpoint: %v", err)
+	}
+	if g != nil {
+		snapshot := g.CurrentSnapshot()
+		logger.Printf("restored game from checkpoint at tick %d (%dx%d, %d players)", snapshot.Tick, snapshot.Width, snapshot.Height, len(snapshot.Players))
 	} else {
-		logger.Printf("WARNING: authentication disabled (ALLOW_INSECURE_AUTH=true)")
+		g = game.NewGame(nextMatch.Width, nextMatch.Height, nextMatch.ResourceBases)
+		if err := g.SetRules(nextMatch.Rules); err != nil {
+			logger.Fatalf("invalid match rules: %v", err)
+		}
+		tickMS = int(nextMatch.TickIntervalMS)
+	}
+	g.SetHistoryLimit(historyTicks)
+
+	colors, err := loadColorConfig()
+	if err != nil {
+		logger.Fatalf("invalid color settings: %v", err)
+	}
+	if err := colors.apply(g); err != nil {
+		logger.Fatalf("invalid color settings: %v", err)
 	}
 
-	g := game.NewGame(width, height, resourceTiles)
+	roles := auth.NewRoleMapper(
+		splitList(getEnv("AUTH_ADMIN_GROUPS", "admin")),
+		splitList(getEnv("AUTH_MODERATOR_GROUPS", "moderator")),
+	)
+	diplomacy := loadDiplomacyConfig()
 
 	srv := &server{
 		game:      g,
 		validator: validator,
-		skipAuth:  skipAuth,
+		roles:     roles,
+		devIssuer: devIssuer,
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
+			Subprotocols:    []string{wsSubprotocol},
 			CheckOrigin: func(r *http.Request) bool {
 				return true
 			},
 		},
 		corsOrigin: os.Getenv("CORS_ALLOWED_ORIGIN"),
+		ws:         loadWSConfig(),
+		clients:    make(map[*wsClient]struct{}),
+
+		store:           store,
+		checkpointEvery: int64(getEnvInt("CHECKPOINT_EVERY_TICKS", 60)),
+		adminToken:      os.Getenv("ADMIN_API_TOKEN"),
+		recordReplays:   strings.EqualFold(getEnv("RECORD_REPLAYS", "true"), "true"),
+		replaySegment:   getEnvInt("REPLAY_SEGMENT_TICKS", 3600),
+		nextMatch:       nextMatch,
+		bans:            bans,
+		profiles:        profiles,
+		colors:          colors,
+		diplomacy:       diplomacy,
+		alliances:       newPendingRequests[allianceKey, allianceRequest](time.Duration(getEnvInt("ALLIANCE_REQUEST_TTL_MS", 60000)) * time.Millisecond),
+		proposals:       newPendingRequests[proposalKey, agreementProposal](diplomacy.ProposalTTL),
+	}
+	srv.chat = chat.NewHub(loadChatConfig(), srv.teamOf)
+	srv.markers, err = markers.Load(context.Background(), store, loadMarkerConfig(), srv.teamOf)
+	if err != nil {
+		logger.Fatalf("failed to load markers: %v", err)
+	}
+	if srv.ws.allowQueryToken {
+		logger.Printf("WS_ALLOW_QUERY_TOKEN is deprecated: tokens in websocket URLs end up in access logs, send an auth message instead")
+	}
+	if err := srv.startRecording(); err != nil {
+		logger.Fatalf("failed to start recording: %v", err)
+	}
+	srv.runner = game.NewRunner(g, time.Duration(tickMS)*time.Millisecond)
+	srv.runner.OnOverrun = func(tick int64, took, interval time.Duration) {
+		logger.Printf("tick %d overran its interval: took %s, interval %s", tick, took, interval)
+	}
+	srv.sessions = newSessionManager(time.Duration(disconnectGraceMS)*time.Millisecond, func(playerID string) {
+		if g.RemovePlayer(playerID) {
+			logger.Printf("removed disconnected player %s", playerID)
+		}
+	})
+	// Restored players start out disconnected and are removed unless they
+	// come back within the grace period.
+	for playerID := range g.CurrentSnapshot().Players {
+		srv.sessions.touch(playerID)
 	}
 
 	mux := http.NewServeMux()
 	mux.Handle("/health", srv.cors(srv.handleHealth()))
+	mux.Handle("/api/palettes", srv.cors(http.HandlerFunc(srv.handlePalettes)))
 	mux.Handle("/api/player", srv.cors(srv.withAuth(http.HandlerFunc(srv.handlePlayer))))
 	mux.Handle("/api/state", srv.cors(srv.withAuth(http.HandlerFunc(srv.handleState))))
+	mux.Handle("/api/state/diff", srv.cors(srv.withAuth(http.HandlerFunc(srv.handleStateDiff))))
+	mux.Handle("/api/replays", srv.cors(srv.withAuth(http.HandlerFunc(srv.handleReplays))))
+	mux.Handle("/api/replays/{id}", srv.cors(srv.withAuth(http.HandlerFunc(srv.handleReplay))))
+	mux.Handle("/api/replays/{id}/stream", srv.withWebsocketAuth(http.HandlerFunc(srv.handleReplayStream)))
+	mux.Handle("/api/admin/loop", srv.cors(srv.withRole(auth.RoleAdmin, http.HandlerFunc(srv.handleAdminLoop))))
+	mux.Handle("/api/admin/loop/{action}", srv.cors(srv.withRole(auth.RoleAdmin, http.HandlerFunc(srv.handleAdminLoopAction))))
+	mux.Handle("/api/admin/players", srv.cors(srv.withRole(auth.RoleModerator, http.HandlerFunc(srv.handleAdminPlayers))))
+	mux.Handle("/api/admin/players/{id}/kick", srv.cors(srv.withRole(auth.RoleModerator, http.HandlerFunc(srv.handleAdminKick))))
+	mux.Handle("/api/admin/players/{id}/ban", srv.cors(srv.withRole(auth.RoleAdmin, http.HandlerFunc(srv.handleAdminBan))))
+	mux.Handle("/api/admin/bans", srv.cors(srv.withRole(auth.RoleModerator, http.HandlerFunc(srv.handleAdminBans))))
+	mux.Handle("/api/admin/match-config", srv.cors(srv.withRole(auth.RoleAdmin, http.HandlerFunc(srv.handleAdminMatchConfig))))
+	mux.Handle("/api/admin/reset", srv.cors(srv.withRole(auth.RoleAdmin, http.HandlerFunc(srv.handleAdminReset))))
+	mux.Handle("/api/admin/tiles/{x}/{y}/{kind}", srv.cors(srv.withRole(auth.RoleAdmin, http.HandlerFunc(srv.handleAdminTile))))
+	mux.Handle("/api/admin/players/{id}/mute", srv.cors(srv.withRole(auth.RoleModerator, http.HandlerFunc(srv.handleAdminMute))))
+	mux.Handle("/api/admin/chat/{id}", srv.cors(srv.withRole(auth.RoleModerator, http.HandlerFunc(srv.handleAdminChatDelete))))
+	mux.Handle("/api/admin/announce", srv.cors(srv.withRole(auth.RoleModerator, http.HandlerFunc(srv.handleAdminAnnounce))))
 	mux.Handle("/ws", srv.withWebsocketAuth(http.HandlerFunc(srv.handleWebsocket)))
+	if devIssuer != nil {
+		prefix := devIssuerPath(devIssuer)
+		mux.Handle(prefix+"/", srv.cors(http.StripPrefix(prefix, devIssuer.Handler())))
+		logger.Printf("WARNING: dev issuer enabled, anyone can mint tokens at %s/token", devIssuer.Config().Issuer)
+	}
 
-	addr := ":" + getEnv("PORT", "8080")
+	addr := ":" + port
 
-	go srv.runTicker(time.Duration(tickMS) * time.Millisecond)
+	httpServer := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+	tickerCtx, stopTicker := context.WithCancel(context.Background())
+	tickerDone := make(chan struct{})
+	srv.runner.OnTick = func(snapshot game.GameSnapshot) {
+		srv.afterTick(tickerCtx, snapshot)
+	}
+	go func() {
+		defer close(tickerDone)
+		srv.runner.Run(tickerCtx)
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	validator.Start(ctx)
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		logger.Printf("shutting down server (deadline %s)", shutdownTimeout)
+
+		// Never outlive the deadline, even if a step hangs.
+		watchdog := time.AfterFunc(shutdownTimeout, func() {
+			logger.Printf("shutdown deadline exceeded, exiting")
+			os.Exit(1)
+		})
+		defer watchdog.Stop()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.shutdown(shutdownCtx, httpServer, func() {
+			stopTicker()
+			<-tickerDone
+		})
+	}()
 
 	logger.Printf("server listening on %s", addr)
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		logger.Fatalf("server error: %v", err)
 	}
+	<-shutdownDone
 }
 
-func (s *server) runTicker(interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		s.game.Tick()
+// afterTick starts a new replay segment once the recording is long enough,
+// and writes a checkpoint and saves the replay every checkpointEvery ticks.
+func (s *server) afterTick(ctx context.Context, snapshot game.GameSnapshot) {
+	if s.replaySegment > 0 && s.game.RecordingTicks() >= s.replaySegment {
+		if err := s.rotateReplay(ctx); err != nil {
+			log.Printf("failed to start a new replay segment at tick %d: %v", snapshot.Tick, err)
+		}
+	}
+	if s.checkpointEvery <= 0 || snapshot.Tick%s.checkpointEvery != 0 {
+		return
+	}
+	if err := s.writeCheckpoint(ctx); err != nil {
+		log.Printf("failed to write checkpoint at tick %d: %v", snapshot.Tick, err)
+	}
+	if err := s.saveReplay(ctx); err != nil {
+		log.Printf("failed to save replay at tick %d: %v", snapshot.Tick, err)
 	}
 }
 
@@ -111,32 +345,48 @@ func (s *server) withAuth(next http.Handler) http.Handler {
 			writeError(w, http.StatusUnauthorized, err)
 			return
 		}
+		if s.bans.has(ctx.Value(playerIDContextKey).(string)) {
+			writeError(w, http.StatusForbidden, errPlayerBanned)
+			return
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func (s *server) withWebsocketAuth(next http.Handler) http.Handler {
+// withRole lets requests through from users holding at least min. A request
+// carrying the ADMIN_API_TOKEN in X-Admin-Token acts as an admin, which
+// keeps scripts working without a user account.
+func (s *server) withRole(min auth.Role, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx, err := s.authenticateWebsocket(r)
-		if err != nil {
-			writeError(w, http.StatusUnauthorized, err)
+		if token := r.Header.Get("X-Admin-Token"); token != "" {
+			if s.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+				writeError(w, http.StatusUnauthorized, errors.New("invalid admin token"))
+				return
+			}
+			ctx := context.WithValue(r.Context(), playerIDContextKey, "admin-token")
+			ctx = context.WithValue(ctx, roleContextKey, auth.RoleAdmin)
+			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
-		next.ServeHTTP(w, r.WithContext(ctx))
+
+		s.withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if role := roleFromContext(r.Context()); !role.AtLeast(min) {
+				writeError(w, http.StatusForbidden, fmt.Errorf("requires the %s role", min))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})).ServeHTTP(w, r)
 	})
 }
 
-func (s *server) authenticateRequest(r *http.Request) (context.Context, error) {
-	if s.skipAuth {
-		player := r.Header.Get("X-Debug-Player")
-		if player == "" {
-			player = "debug-" + strconv.FormatInt(time.Now().UnixNano(), 10)
-		}
-
-		ctx := context.WithValue(r.Context(), playerIDContextKey, player)
-		return ctx, nil
+func roleFromContext(ctx context.Context) auth.Role {
+	if role, ok := ctx.Value(roleContextKey).(auth.Role); ok {
+		return role
 	}
+	return auth.RolePlayer
+}
 
+func (s *server) authenticateRequest(r *http.Request) (context.Context, error) {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
 		return nil, errors.New("missing Authorization header")
@@ -147,130 +397,105 @@ func (s *server) authenticateRequest(r *http.Request) (context.Context, error) {
 		return nil, errors.New("invalid Authorization header")
 	}
 
-	_, claims, err := s.validator.Validate(parts[1])
-	if err != nil {
-		return nil, err
-	}
-
-	subject, _ := claims["sub"].(string)
-	if subject == "" {
-		return nil, errors.New("token missing subject")
-	}
-
-	ctx := context.WithValue(r.Context(), playerIDContextKey, subject)
-	ctx = context.WithValue(ctx, claimsContextKey, claims)
-	return ctx, nil
+	return s.identify(r.Context(), parts[1])
 }
 
-func (s *server) authenticateWebsocket(r *http.Request) (context.Context, error) {
-	if s.skipAuth {
-		player := r.URL.Query().Get("playerId")
-		if player == "" {
-			player = "debug-" + strconv.FormatInt(time.Now().UnixNano(), 10)
-		}
-
-		return context.WithValue(r.Context(), playerIDContextKey, player), nil
-	}
-
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		return nil, errors.New("missing token query parameter")
-	}
-
-	_, claims, err := s.validator.Validate(token)
+// identify validates the token and adds the player, claims and role to ctx.
+func (s *server) identify(ctx context.Context, token string) (context.Context, error) {
+	identity, err := s.validator.Validate(token)
 	if err != nil {
 		return nil, err
 	}
 
-	subject, _ := claims["sub"].(string)
-	if subject == "" {
-		return nil, errors.New("token missing subject")
-	}
-
-	ctx := context.WithValue(r.Context(), playerIDContextKey, subject)
-	ctx = context.WithValue(ctx, claimsContextKey, claims)
+	ctx = context.WithValue(ctx, playerIDContextKey, identity.Subject)
+	ctx = context.WithValue(ctx, claimsContextKey, identity.Claims)
+	ctx = context.WithValue(ctx, roleContextKey, s.roles.Role(identity.Groups))
 	return ctx, nil
 }
 
+// handleHealth reports "degraded" while any issuer's keys are stale. Tokens
+// are still validated with the cached keys, so this stays a 200.
 func (s *server) handleHealth() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		keys := s.validator.KeyStatus()
+		status := "ok"
+		for _, key := range keys {
+			if key.Stale {
+				status = "degraded"
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": status, "auth": keys})
 	})
 }
 
-func (s *server) handlePlayer(w http.ResponseWriter, r *http.Request) {
-	playerID := r.Context().Value(playerIDContextKey).(string)
+func (s *server) handleState(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("tick") == "" {
+		writeJSON(w, http.StatusOK, s.game.CurrentSnapshot())
+		return
+	}
 
-	player, err := s.game.AddPlayer(playerID)
+	tick, err := queryTick(r, "tick")
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	snapshot, err := s.game.SnapshotAt(tick)
+	if err != nil {
+		s.writeHistoryError(w, err)
 		return
 	}
-
-	writeJSON(w, http.StatusOK, player)
-}
-
-func (s *server) handleState(w http.ResponseWriter, r *http.Request) {
-	snapshot := s.game.CurrentSnapshot()
 	writeJSON(w, http.StatusOK, snapshot)
 }
 
-func (s *server) handleWebsocket(w http.ResponseWriter, r *http.Request) {
-	playerID := r.Context().Value(playerIDContextKey).(string)
-
-	conn, err := s.upgrader.Upgrade(w, r, nil)
+func (s *server) handleStateDiff(w http.ResponseWriter, r *http.Request) {
+	from, err := queryTick(r, "from")
 	if err != nil {
-		log.Printf("failed to upgrade websocket: %v", err)
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	defer conn.Close()
-
-	player, err := s.game.AddPlayer(playerID)
+	to, err := queryTick(r, "to")
 	if err != nil {
-		_ = conn.WriteJSON(map[string]string{"error": err.Error()})
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	welcome := wsMessage{
-		Type:     "welcome",
-		Player:   player,
-		Snapshot: ptrSnapshot(s.game.CurrentSnapshot()),
-	}
-
-	if err := conn.WriteJSON(welcome); err != nil {
-		log.Printf("failed to send welcome: %v", err)
+	delta, err := s.game.DiffTicks(from, to)
+	if err != nil {
+		s.writeHistoryError(w, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, delta)
+}
 
-	updates, unsubscribe := s.game.Subscribe(2)
-	defer unsubscribe()
-
-	done := make(chan struct{})
+func queryTick(r *http.Request, name string) (int64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, fmt.Errorf("%s is required", name)
+	}
+	tick, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || tick < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative tick number", name)
+	}
+	return tick, nil
+}
 
-	go func() {
-		defer close(done)
-		for {
-			if _, _, err := conn.NextReader(); err != nil {
-				return
-			}
-		}
-	}()
+// writeHistoryError tells the caller which ticks can still be queried, so a
+// client asking for an aged-out tick knows how far back it may go.
+func (s *server) writeHistoryError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, game.ErrTickExpired):
+		status = http.StatusGone
+	case errors.Is(err, game.ErrTickInFuture):
+		status = http.StatusNotFound
+	}
 
-	for {
-		select {
-		case snapshot, ok := <-updates:
-			if !ok {
-				return
-			}
-			message := wsMessage{Type: "snapshot", Snapshot: &snapshot}
-			if err := conn.WriteJSON(message); err != nil {
-				log.Printf("failed to write snapshot: %v", err)
-				return
-			}
-		case <-done:
-			return
-		}
+	body := map[string]any{"error": err.Error()}
+	if oldest, latest, ok := s.game.HistoryRange(); ok {
+		body["oldestTick"] = oldest
+		body["latestTick"] = latest
 	}
+	writeJSON(w, status, body)
 }
 
 func (s *server) cors(next http.Handler) http.Handler {
@@ -280,8 +505,8 @@ func (s *server) cors(next http.Handler) http.Handler {
 			origin = "*"
 		}
 		w.Header().Set("Access-Control-Allow-Origin", origin)
-		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Debug-Player")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Admin-Token")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		if r.Method == http.MethodOptions {
@@ -293,6 +518,19 @@ func (s *server) cors(next http.Handler) http.Handler {
 	})
 }
 
+// maxJSONBodyBytes limits the request bodies read by readJSONBody.
+const maxJSONBodyBytes = 1 << 16
+
+// readJSONBody decodes an optional JSON body; an empty body leaves out
+// untouched.
+func readJSONBody(r *http.Request, out interface{}) error {
+	err := json.NewDecoder(io.LimitReader(r.Body, maxJSONBodyBytes)).Decode(out)
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+	return errors.New("invalid request body")
+}
+
 func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -309,6 +547,22 @@ func ptrSnapshot(snapshot game.GameSnapshot) *game.GameSnapshot {
 	return &snapshot
 }
 
+func openStore(backend, dir string) (storage.Store, error) {
+	switch strings.ToLower(backend) {
+	case "file":
+		// A default under the temp dir would silently lose bans, profiles and
+		// replays on hosts that clean it, so the directory has to be chosen.
+		if dir == "" {
+			return nil, errors.New("STORAGE_DIR must be set for the file storage backend")
+		}
+		return storage.NewFileStore(dir)
+	case "memory":
+		return storage.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
 func getEnv(key, fallback string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -329,3 +583,14 @@ func getEnvInt(key string, fallback int) int {
 	}
 	return i
 }
+
+// splitList splits a comma separated setting, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
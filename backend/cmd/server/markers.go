@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/game"
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/markers"
+)
+
+func loadMarkerConfig() markers.Config {
+	return markers.Config{
+		PingTTL:    time.Duration(getEnvInt("PING_TTL_MS", int(markers.DefaultConfig.PingTTL.Milliseconds()))) * time.Millisecond,
+		PingLimit:  getEnvInt("PING_RATE_LIMIT", markers.DefaultConfig.PingLimit),
+		PingWindow: time.Duration(getEnvInt("PING_RATE_WINDOW_MS", int(markers.DefaultConfig.PingWindow.Milliseconds()))) * time.Millisecond,
+		MaxMarkers: getEnvInt("MARKERS_PER_PLAYER", markers.DefaultConfig.MaxMarkers),
+	}
+}
+
+// handlePing places a ping, e.g.
+// {"type":"ping","kind":"attack","position":{"x":3,"y":4}}, and sends it to
+// the sender and their allies.
+func (s *server) handlePing(client *wsClient, message wsIncoming) {
+	if message.Position == nil || !s.game.InBounds(*message.Position) {
+		client.enqueue(wsMessage{Type: "pingError", Message: game.ErrOutOfBounds.Error()})
+		return
+	}
+
+	ping, err := s.markers.Ping(client.playerID, markers.PingKind(message.Kind), *message.Position)
+	if err != nil {
+		client.enqueue(wsMessage{Type: "pingError", Message: err.Error()})
+		return
+	}
+	for _, c := range s.connectedClients(false) {
+		if s.markers.VisibleTo(ping, c.playerID) {
+			c.enqueue(wsMessage{Type: "ping", Ping: &ping})
+		}
+	}
+}
+
+// handleMarker places a personal marker, e.g.
+// {"type":"marker","position":{"x":3,"y":4},"label":"gold"}. Markers are only
+// sent to the player's own connections.
+func (s *server) handleMarker(client *wsClient, message wsIncoming) {
+	if message.Position == nil || !s.game.InBounds(*message.Position) {
+		client.enqueue(wsMessage{Type: "markerError", Message: game.ErrOutOfBounds.Error()})
+		return
+	}
+
+	marker, err := s.markers.AddMarker(context.Background(), client.playerID, *message.Position, message.Label)
+	if err != nil {
+		client.enqueue(wsMessage{Type: "markerError", Message: err.Error()})
+		return
+	}
+	s.sendToPlayer(client.playerID, wsMessage{Type: "marker", Marker: &marker})
+}
+
+// handleRemoveMarker removes a marker, e.g. {"type":"removeMarker","id":"m3"}.
+func (s *server) handleRemoveMarker(client *wsClient, message wsIncoming) {
+	if err := s.markers.RemoveMarker(context.Background(), client.playerID, message.ID); err != nil {
+		client.enqueue(wsMessage{Type: "markerError", Message: err.Error()})
+		return
+	}
+	s.sendToPlayer(client.playerID, wsMessage{Type: "markerRemoved", Marker: &markers.Marker{ID: message.ID, PlayerID: client.playerID}})
+}
+
+// sendToPlayer queues a message on every connection of a player.
+func (s *server) sendToPlayer(playerID string, message wsMessage) {
+	for _, client := range s.connectedClients(false) {
+		if client.playerID == playerID {
+			client.enqueue(message)
+		}
+	}
+}
+
+// clearMarkers drops pings and markers when a new board starts.
+func (s *server) clearMarkers(ctx context.Context) {
+	if err := s.markers.Clear(ctx); err != nil {
+		log.Printf("failed to clear markers: %v", err)
+	}
+}
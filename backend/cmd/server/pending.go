@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// pendingRequests keeps requests between players, such as alliance requests
+// and agreement proposals, until they are answered or expire. They are not
+// part of the game until accepted, so they are not saved.
+type pendingRequests[K comparable, V any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	pending map[K]pendingRequest[V]
+}
+
+type pendingRequest[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+func newPendingRequests[K comparable, V any](ttl time.Duration) *pendingRequests[K, V] {
+	return &pendingRequests[K, V]{ttl: ttl, pending: make(map[K]pendingRequest[V])}
+}
+
+// add stores the request that newValue builds for its expiry under key,
+// replacing an earlier one. Expired requests that were never answered are
+// dropped on the way.
+func (p *pendingRequests[K, V]) add(key K, newValue func(expiresAt time.Time) V) V {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for k, req := range p.pending {
+		if !now.Before(req.expiresAt) {
+			delete(p.pending, k)
+		}
+	}
+
+	expiresAt := now.Add(p.ttl).UTC()
+	value := newValue(expiresAt)
+	p.pending[key] = pendingRequest[V]{value: value, expiresAt: expiresAt}
+	return value
+}
+
+// take removes a request and reports whether it was still valid.
+func (p *pendingRequests[K, V]) take(key K) (V, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	req, ok := p.pending[key]
+	delete(p.pending, key)
+	return req.value, ok && time.Now().Before(req.expiresAt)
+}
+
+func (p *pendingRequests[K, V]) clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = make(map[K]pendingRequest[V])
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPendingRequestsDropExpiredEntries(t *testing.T) {
+	p := newPendingRequests[string, string](time.Minute)
+	p.add("a", func(time.Time) string { return "first" })
+	p.add("b", func(time.Time) string { return "second" })
+	expired := p.pending["a"]
+	expired.expiresAt = time.Now().Add(-time.Second)
+	p.pending["a"] = expired
+
+	p.add("c", func(time.Time) string { return "third" })
+	if _, ok := p.pending["a"]; ok {
+		t.Fatal("expected the expired request to be dropped")
+	}
+	if len(p.pending) != 2 {
+		t.Fatalf("expected the live requests to stay, got %v", p.pending)
+	}
+
+	if got, ok := p.take("b"); !ok || got != "second" {
+		t.Fatalf("expected to take the second request, got %q, %v", got, ok)
+	}
+	if _, ok := p.take("b"); ok {
+		t.Fatal("expected a request to be taken only once")
+	}
+}
+
+func TestPendingRequestsRejectExpiredTake(t *testing.T) {
+	p := newPendingRequests[string, string](-time.Second)
+	p.add("a", func(time.Time) string { return "late" })
+	if _, ok := p.take("a"); ok {
+		t.Fatal("expected an expired request to be rejected")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/auth"
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/game"
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/profile"
+)
+
+type playerResponse struct {
+	*game.Player
+	Role  auth.Role `json:"role"`
+	Email string    `json:"email,omitempty"`
+}
+
+// ensureProfile creates the player's profile from their token on first sight
+// and keeps the email in sync with it.
+func (s *server) ensureProfile(ctx context.Context, playerID string) (profile.Profile, error) {
+	var claims profile.Claims
+	if tokenClaims, ok := ctx.Value(claimsContextKey).(jwt.MapClaims); ok {
+		claims.PreferredUsername, _ = tokenClaims["preferred_username"].(string)
+		claims.Email, _ = tokenClaims["email"].(string)
+	}
+	return s.profiles.Ensure(ctx, playerID, claims)
+}
+
+// joinGame adds the player to the game with their display name and, if no
+// one else is using it, their preferred color.
+func (s *server) joinGame(playerID string) (*game.Player, error) {
+	player, err := s.game.AddPlayer(playerID)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := s.profiles.Get(playerID)
+	if !ok {
+		return player, nil
+	}
+	if err := s.applyProfile(p); err != nil {
+		return nil, err
+	}
+	player, _ = s.game.Player(playerID)
+	return player, nil
+}
+
+// applyProfile shows the profile in the game. A preferred color that is too
+// close to another player's, or no longer offered, is skipped rather than
+// failing the join.
+func (s *server) applyProfile(p profile.Profile) error {
+	color := p.Color
+	if !s.colors.offers(color) {
+		color = ""
+	}
+	err := s.game.SetProfile(p.PlayerID, p.DisplayName, color)
+	if errors.Is(err, game.ErrColorTaken) {
+		err = s.game.SetProfile(p.PlayerID, p.DisplayName, "")
+	}
+	if errors.Is(err, game.ErrUnknownPlayer) {
+		return nil
+	}
+	return err
+}
+
+func (s *server) handlePlayer(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleGetPlayer(w, r)
+	case http.MethodPatch:
+		s.handlePatchPlayer(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (s *server) handleGetPlayer(w http.ResponseWriter, r *http.Request) {
+	playerID := r.Context().Value(playerIDContextKey).(string)
+
+	s.sessions.touch(playerID)
+
+	p, err := s.ensureProfile(r.Context(), playerID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	player, err := s.joinGame(playerID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, playerResponse{player, roleFromContext(r.Context()), p.Email})
+}
+
+// handlePatchPlayer changes the caller's display name and preferred color,
+// e.g. {"displayName":"Alice","color":"#0072b2"}. The color must be from one
+// of the offered palettes and far enough from other players' colors.
+func (s *server) handlePatchPlayer(w http.ResponseWriter, r *http.Request) {
+	playerID := r.Context().Value(playerIDContextKey).(string)
+
+	var update profile.Update
+	if err := readJSONBody(r, &update); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if update.Color != nil && *update.Color != "" {
+		color, err := profile.NormalizeColor(*update.Color)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if !s.colors.offers(color) {
+			writeError(w, http.StatusBadRequest, errColorNotOffered)
+			return
+		}
+		if !s.game.ColorAvailable(playerID, color) {
+			writeError(w, http.StatusConflict, game.ErrColorTaken)
+			return
+		}
+	}
+
+	p, err := s.profiles.Update(r.Context(), playerID, update)
+	switch {
+	case errors.Is(err, profile.ErrNameTaken):
+		writeError(w, http.StatusConflict, err)
+		return
+	case errors.Is(err, profile.ErrNameLength), errors.Is(err, profile.ErrNameInvalid),
+		errors.Is(err, profile.ErrNameBlocked), errors.Is(err, profile.ErrInvalidColor):
+		writeError(w, http.StatusBadRequest, err)
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := s.applyProfile(p); err != nil {
+		log.Printf("failed to apply profile of %s: %v", playerID, err)
+	}
+
+	player, ok := s.game.Player(playerID)
+	if !ok {
+		player = &game.Player{ID: playerID, DisplayName: p.DisplayName, Color: p.Color}
+	}
+	writeJSON(w, http.StatusOK, playerResponse{player, roleFromContext(r.Context()), p.Email})
+}
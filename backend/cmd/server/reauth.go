@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/chat"
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/game"
+)
+
+// closeTokenExpired is sent when a connection's token expired without the
+// client sending a fresh one.
+const closeTokenExpired = 4001
+
+// wsIncoming is the envelope of messages sent by clients.
+type wsIncoming struct {
+	Type  string `json:"type"`
+	Token string `json:"token,omitempty"`
+
+	// Channel, To and Text are set by chat messages.
+	Channel chat.Channel `json:"channel,omitempty"`
+	To      string       `json:"to,omitempty"`
+	Text    string       `json:"text,omitempty"`
+
+	// Kind, Position, Label and ID are set by ping and marker messages.
+	Kind     string         `json:"kind,omitempty"`
+	Position *game.Position `json:"position,omitempty"`
+	Label    string         `json:"label,omitempty"`
+	ID       string         `json:"id,omitempty"`
+
+	// PlayerID is the other player of alliance and agreement messages.
+	PlayerID string `json:"playerId,omitempty"`
+	// Ticks is how long a proposed agreement lasts.
+	Ticks int64 `json:"ticks,omitempty"`
+}
+
+// tokenExpiry returns when the token that authenticated the request expires.
+func tokenExpiry(ctx context.Context) (time.Time, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(jwt.MapClaims)
+	if !ok {
+		return time.Time{}, false
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return time.Time{}, false
+	}
+	return exp.Time, true
+}
+
+// watchExpiry sends a tokenExpiring message ahead of the token's expiry and
+// closes the connection once it expires, unless a reauth message extends it
+// in the meantime. Each expiry is warned about once, so a reauth with a token
+// that is about to expire as well does not start a warning loop.
+func (s *server) watchExpiry(client *wsClient, expiresAt time.Time) {
+	var warnedFor time.Time
+	timer := time.NewTimer(time.Until(expiresAt) - s.ws.tokenWarning)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-client.done:
+			return
+		case expiresAt = <-client.reauthed:
+		case <-timer.C:
+			if !time.Now().Before(expiresAt) {
+				client.close(closeTokenExpired, "token expired")
+				return
+			}
+			if !warnedFor.Equal(expiresAt) {
+				warnedFor = expiresAt
+				client.enqueue(wsMessage{Type: "tokenExpiring", ExpiresAt: &expiresAt})
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		next := time.Until(expiresAt)
+		if !warnedFor.Equal(expiresAt) {
+			next -= s.ws.tokenWarning
+		}
+		timer.Reset(next)
+	}
+}
+
+// handleReauth handles a reauth message carrying a fresh token for the
+// connected player. It reports false for any other message.
+func (s *server) handleReauth(client *wsClient, data []byte) bool {
+	var message wsIncoming
+	if err := json.Unmarshal(data, &message); err != nil || message.Type != "reauth" {
+		return false
+	}
+
+	expiresAt, err := s.validateReauth(client, message.Token)
+	if err != nil {
+		client.enqueue(wsMessage{Type: "reauthFailed", Message: err.Error()})
+		return true
+	}
+
+	// Only the latest expiry matters, so a pending one is replaced.
+	select {
+	case <-client.reauthed:
+	default:
+	}
+	client.reauthed <- expiresAt
+	client.enqueue(wsMessage{Type: "reauthOk", ExpiresAt: &expiresAt})
+	return true
+}
+
+func (s *server) validateReauth(client *wsClient, token string) (time.Time, error) {
+	identity, err := s.validator.Validate(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if identity.Subject != client.playerID {
+		return time.Time{}, errors.New("token belongs to a different player")
+	}
+	if s.bans.has(identity.Subject) {
+		return time.Time{}, errPlayerBanned
+	}
+	exp, err := identity.Claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return time.Time{}, errors.New("token has no expiry")
+	}
+	return exp.Time, nil
+}
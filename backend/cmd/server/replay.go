@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/game"
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/storage"
+)
+
+const (
+	minReplaySpeed = 0.1
+	maxReplaySpeed = 64.0
+)
+
+type replaySummary struct {
+	ID         string            `json:"id"`
+	Seed       int64             `json:"seed"`
+	Config     game.ReplayConfig `json:"config"`
+	StartTick  int64             `json:"startTick"`
+	EndTick    int64             `json:"endTick"`
+	EventCount int               `json:"eventCount"`
+	Continues  string            `json:"continues,omitempty"`
+}
+
+type replayDetails struct {
+	replaySummary
+	Events []game.ReplayEvent `json:"events"`
+}
+
+// replayStatus is sent to replay viewers whenever playback state changes.
+type replayStatus struct {
+	ID        string  `json:"id"`
+	Tick      int64   `json:"tick"`
+	StartTick int64   `json:"startTick"`
+	EndTick   int64   `json:"endTick"`
+	Paused    bool    `json:"paused"`
+	Speed     float64 `json:"speed"`
+}
+
+// replayControl is a message sent by a replay viewer: pause, resume, step,
+// seek (with tick) or speed (with speed).
+type replayControl struct {
+	Type  string  `json:"type"`
+	Tick  int64   `json:"tick,omitempty"`
+	Speed float64 `json:"speed,omitempty"`
+}
+
+func summarizeReplay(l game.ReplayLog) replaySummary {
+	return replaySummary{
+		ID:         l.ID,
+		Seed:       l.Seed,
+		Config:     l.Config,
+		StartTick:  l.StartTick,
+		EndTick:    l.EndTick(),
+		EventCount: len(l.Events),
+		Continues:  l.Continues,
+	}
+}
+
+func (s *server) loadReplay(ctx context.Context, id string) (game.ReplayLog, error) {
+	var l game.ReplayLog
+	err := storage.GetJSON(ctx, s.store, storage.CollectionMatches, id, &l)
+	return l, err
+}
+
+func (s *server) handleReplays(w http.ResponseWriter, r *http.Request) {
+	ids, err := s.store.List(r.Context(), storage.CollectionMatchSummaries)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	summaries := make([]replaySummary, 0, len(ids))
+	for _, id := range ids {
+		var summary replaySummary
+		if err := storage.GetJSON(r.Context(), s.store, storage.CollectionMatchSummaries, id, &summary); err != nil {
+			log.Printf("skipping unreadable replay summary %s: %v", id, err)
+			continue
+		}
+		summaries = append(summaries, summary)
+	}
+
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+func (s *server) handleReplay(w http.ResponseWriter, r *http.Request) {
+	l, err := s.loadReplay(r.Context(), r.PathValue("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		writeError(w, http.StatusNotFound, errors.New("replay not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, replayDetails{
+		replaySummary: summarizeReplay(l),
+		Events:        l.Events,
+	})
+}
+
+// handleReplayStream plays a recorded match over a websocket using the same
+// snapshot messages as live games. The query may set the starting tick and
+// playback speed; the viewer controls playback with replayControl messages.
+func (s *server) handleReplayStream(w http.ResponseWriter, r *http.Request) {
+	l, err := s.loadReplay(r.Context(), r.PathValue("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		writeError(w, http.StatusNotFound, errors.New("replay not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	replayer, err := game.NewReplayer(l)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	query := r.URL.Query()
+	speed := 1.0
+	if value := query.Get("speed"); value != "" {
+		if speed, err = strconv.ParseFloat(value, 64); err != nil || !validReplaySpeed(speed) {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("speed must be between %g and %g", minReplaySpeed, maxReplaySpeed))
+			return
+		}
+	}
+	if value := query.Get("tick"); value != "" {
+		tick, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("invalid tick"))
+			return
+		}
+		if _, err := replayer.SeekTick(tick); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	conn, ctx, ok := s.upgradeWebsocket(w, r)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+
+	client := newWSClient(conn, ctx.Value(playerIDContextKey).(string))
+	client.spectator = true
+	if !s.registerClient(client) {
+		s.writeClose(conn, websocket.CloseGoingAway, "server shutting down")
+		return
+	}
+	defer s.unregisterClient(client)
+
+	controls := make(chan replayControl, 8)
+	if expiresAt, ok := tokenExpiry(ctx); ok {
+		go s.watchExpiry(client, expiresAt)
+	}
+	s.armReadDeadline(conn)
+	go s.readWebsocket(client, func(data []byte) {
+		if s.handleReauth(client, data) {
+			return
+		}
+		var control replayControl
+		if err := json.Unmarshal(data, &control); err != nil {
+			client.enqueue(wsMessage{Type: "error", Message: "invalid replay control"})
+			return
+		}
+		select {
+		case controls <- control:
+		case <-client.done:
+		}
+	})
+
+	s.playReplay(client, replayer, speed, controls)
+}
+
+func (s *server) playReplay(client *wsClient, replayer *game.Replayer, speed float64, controls <-chan replayControl) {
+	conn := client.conn
+	l := replayer.Log()
+	paused := false
+
+	status := func() wsMessage {
+		return wsMessage{Type: "replay", Replay: &replayStatus{
+			ID:        l.ID,
+			Tick:      replayer.Tick(),
+			StartTick: l.StartTick,
+			EndTick:   l.EndTick(),
+			Paused:    paused || replayer.Done(),
+			Speed:     speed,
+		}}
+	}
+	// Seeks are sent as replaySeek, which replaces the snapshot whatever its
+	// tick; clients drop snapshot messages that are not newer than theirs.
+	sendSnapshot := func(kind string, snapshot game.GameSnapshot) bool {
+		if err := s.writeJSON(conn, wsMessage{Type: kind, Snapshot: &snapshot}); err != nil {
+			log.Printf("failed to write replay snapshot: %v", err)
+			return false
+		}
+		return true
+	}
+	step := func() bool {
+		snapshot, err := replayer.Step()
+		if err != nil {
+			log.Printf("replay %s stopped: %v", l.ID, err)
+			client.enqueue(wsMessage{Type: "error", Message: err.Error()})
+			paused = true
+			return s.writeJSON(conn, status()) == nil
+		}
+		return sendSnapshot("snapshot", snapshot)
+	}
+
+	if !sendSnapshot("snapshot", replayer.Snapshot()) || s.writeJSON(conn, status()) != nil {
+		return
+	}
+
+	// Speed 1 plays at the live game's current pace, so the interval follows
+	// changes made through the admin loop API.
+	interval := replayInterval(s.runner.TickInterval(), speed)
+	advance := time.NewTicker(interval)
+	defer advance.Stop()
+	retime := func() {
+		if next := replayInterval(s.runner.TickInterval(), speed); next != interval {
+			interval = next
+			advance.Reset(interval)
+		}
+	}
+	ping := time.NewTicker(s.ws.pingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-advance.C:
+			retime()
+			if paused || replayer.Done() {
+				continue
+			}
+			if !step() {
+				return
+			}
+			if replayer.Done() && s.writeJSON(conn, status()) != nil {
+				return
+			}
+		case control := <-controls:
+			switch control.Type {
+			case "pause":
+				paused = true
+			case "resume":
+				paused = false
+			case "step":
+				paused = true
+				if !replayer.Done() && !step() {
+					return
+				}
+			case "seek":
+				snapshot, err := replayer.SeekTick(control.Tick)
+				if err != nil {
+					client.enqueue(wsMessage{Type: "error", Message: err.Error()})
+					continue
+				}
+				if !sendSnapshot("replaySeek", snapshot) {
+					return
+				}
+			case "speed":
+				if !validReplaySpeed(control.Speed) {
+					client.enqueue(wsMessage{Type: "error", Message: fmt.Sprintf("speed must be between %g and %g", minReplaySpeed, maxReplaySpeed)})
+					continue
+				}
+				speed = control.Speed
+				retime()
+			default:
+				client.enqueue(wsMessage{Type: "error", Message: fmt.Sprintf("unknown replay control %q", control.Type)})
+				continue
+			}
+			if s.writeJSON(conn, status()) != nil {
+				return
+			}
+		case message := <-client.send:
+			if err := s.writeJSON(conn, message); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := s.writePing(conn); err != nil {
+				return
+			}
+		case <-client.done:
+			s.finishClient(client)
+			return
+		}
+	}
+}
+
+func validReplaySpeed(speed float64) bool {
+	return speed >= minReplaySpeed && speed <= maxReplaySpeed
+}
+
+func replayInterval(tickInterval time.Duration, speed float64) time.Duration {
+	interval := time.Duration(float64(tickInterval) / speed)
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	return interval
+}
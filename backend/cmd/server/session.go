@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+var errInvalidResumeToken = errors.New("invalid resume token")
+
+// session ties a player to a resume token and keeps track of how many
+// websockets the player has open, so that the player can be removed from the
+// game once they have been gone for longer than the grace period.
+type session struct {
+	token          string
+	playerID       string
+	conns          int
+	removal        *time.Timer
+	disconnectedAt time.Time
+}
+
+type sessionManager struct {
+	mu       sync.Mutex
+	byToken  map[string]*session
+	byPlayer map[string]*session
+	grace    time.Duration
+	onExpire func(playerID string)
+}
+
+func newSessionManager(grace time.Duration, onExpire func(playerID string)) *sessionManager {
+	return &sessionManager{
+		byToken:  make(map[string]*session),
+		byPlayer: make(map[string]*session),
+		grace:    grace,
+		onExpire: onExpire,
+	}
+}
+
+// connect registers a new websocket for the player and cancels any pending
+// removal. The returned token can be presented later to resume.
+func (m *sessionManager) connect(playerID string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess := m.sessionLocked(playerID)
+	sess.conns++
+	sess.disconnectedAt = time.Time{}
+	m.cancelRemovalLocked(sess)
+	return sess.token
+}
+
+// resume is like connect but only succeeds when the token still belongs to
+// the same player, meaning the player has not been removed in the meantime.
+func (m *sessionManager) resume(token, playerID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.byToken[token]
+	if !ok || sess.playerID != playerID {
+		return "", errInvalidResumeToken
+	}
+
+	sess.conns++
+	sess.disconnectedAt = time.Time{}
+	m.cancelRemovalLocked(sess)
+	return sess.token, nil
+}
+
+// touch makes sure a player that joined without a websocket is still removed
+// if they never connect.
+func (m *sessionManager) touch(playerID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess := m.sessionLocked(playerID)
+	if sess.conns == 0 && sess.removal == nil {
+		if sess.disconnectedAt.IsZero() {
+			sess.disconnectedAt = time.Now()
+		}
+		m.scheduleRemovalLocked(sess)
+	}
+}
+
+// disconnect releases a websocket claimed with connect or resume. Taking the
+// token rather than the player means a connection from a dropped session
+// cannot affect a newer session of the same player.
+func (m *sessionManager) disconnect(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.byToken[token]
+	if !ok {
+		return
+	}
+
+	if sess.conns > 0 {
+		sess.conns--
+	}
+	if sess.conns == 0 {
+		sess.disconnectedAt = time.Now()
+		m.scheduleRemovalLocked(sess)
+	}
+}
+
+// status reports how many websockets the player has open and, when none,
+// since when the player has been disconnected.
+func (m *sessionManager) status(playerID string) (conns int, disconnectedAt time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.byPlayer[playerID]
+	if !ok {
+		return 0, time.Time{}
+	}
+	return sess.conns, sess.disconnectedAt
+}
+
+// drop forgets the player's session, which invalidates the resume token and
+// cancels a pending removal.
+func (m *sessionManager) drop(playerID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.byPlayer[playerID]
+	if !ok {
+		return
+	}
+	m.cancelRemovalLocked(sess)
+	delete(m.byPlayer, playerID)
+	delete(m.byToken, sess.token)
+}
+
+func (m *sessionManager) sessionLocked(playerID string) *session {
+	if sess, ok := m.byPlayer[playerID]; ok {
+		return sess
+	}
+
+	sess := &session{
+		token:    newResumeToken(),
+		playerID: playerID,
+	}
+	m.byPlayer[playerID] = sess
+	m.byToken[sess.token] = sess
+	return sess
+}
+
+func (m *sessionManager) cancelRemovalLocked(sess *session) {
+	if sess.removal != nil {
+		sess.removal.Stop()
+		sess.removal = nil
+	}
+}
+
+func (m *sessionManager) scheduleRemovalLocked(sess *session) {
+	m.cancelRemovalLocked(sess)
+	if m.grace <= 0 {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(m.grace, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		// A resume may have raced with the timer firing.
+		if sess.removal != timer || sess.conns > 0 {
+			return
+		}
+		delete(m.byPlayer, sess.playerID)
+		delete(m.byToken, sess.token)
+
+		// Expiring under the lock keeps a reconnect from slipping in between
+		// the session being dropped and the player leaving the game.
+		if m.onExpire != nil {
+			m.onExpire(sess.playerID)
+		}
+	})
+	sess.removal = timer
+}
+
+func newResumeToken() string {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
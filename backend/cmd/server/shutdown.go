@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// shutdown stops the server in an order that never loses a tick: new
+// connections are refused first, then the ticker is stopped once the current
+// tick has finished, the game is checkpointed and finally the connected
+// clients are told that the server is restarting.
+func (s *server) shutdown(ctx context.Context, httpServer *http.Server, stopTicker func()) {
+	httpDone := make(chan error, 1)
+	go func() {
+		httpDone <- httpServer.Shutdown(ctx)
+	}()
+
+	stopTicker()
+
+	if err := s.writeCheckpoint(ctx); err != nil {
+		log.Printf("failed to write checkpoint: %v", err)
+	} else {
+		log.Printf("wrote checkpoint at tick %d", s.game.CurrentSnapshot().Tick)
+	}
+	if err := s.saveReplay(ctx); err != nil {
+		log.Printf("failed to save replay: %v", err)
+	}
+
+	notice := &wsMessage{Type: "restarting", Message: "server restarting"}
+	timeout := s.ws.writeTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	// Hijacked websocket connections are not tracked by http.Server, so they
+	// have to be closed explicitly.
+	s.closeAllClients(notice, websocket.CloseServiceRestart, "server restarting", timeout)
+
+	select {
+	case err := <-httpDone:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("http shutdown error: %v", err)
+		}
+	case <-ctx.Done():
+		log.Printf("http shutdown did not finish before the deadline")
+	}
+
+	if err := s.store.Close(); err != nil {
+		log.Printf("failed to close storage: %v", err)
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/game"
+)
+
+const (
+	wsMaxMessageBytes    = 4096
+	defaultWSIdleTimeout = 60 * time.Second
+)
+
+type wsConfig struct {
+	pingInterval time.Duration
+	idleTimeout  time.Duration
+	writeTimeout time.Duration
+	tokenWarning time.Duration
+	authTimeout  time.Duration
+
+	// allowQueryToken accepts the deprecated ?token= query parameter.
+	allowQueryToken bool
+}
+
+func loadWSConfig() wsConfig {
+	cfg := wsConfig{
+		pingInterval: time.Duration(getEnvInt("WS_PING_INTERVAL_MS", 25000)) * time.Millisecond,
+		idleTimeout:  time.Duration(getEnvInt("WS_IDLE_TIMEOUT_MS", int(defaultWSIdleTimeout/time.Millisecond))) * time.Millisecond,
+		writeTimeout: time.Duration(getEnvInt("WS_WRITE_TIMEOUT_MS", 10000)) * time.Millisecond,
+		tokenWarning: time.Duration(getEnvInt("WS_TOKEN_EXPIRY_WARNING_MS", 60000)) * time.Millisecond,
+		authTimeout:  time.Duration(getEnvInt("WS_AUTH_TIMEOUT_MS", 5000)) * time.Millisecond,
+
+		allowQueryToken: strings.EqualFold(os.Getenv("WS_ALLOW_QUERY_TOKEN"), "true"),
+	}
+
+	// Without a positive idle timeout every read deadline would already have
+	// passed and each connection would drop on its first read.
+	if cfg.idleTimeout <= 0 {
+		log.Printf("WS_IDLE_TIMEOUT_MS must be positive, using %s", defaultWSIdleTimeout)
+		cfg.idleTimeout = defaultWSIdleTimeout
+	}
+
+	// A ping must land before the peer's read deadline expires, otherwise
+	// healthy but quiet connections would be dropped.
+	if cfg.pingInterval <= 0 || cfg.pingInterval >= cfg.idleTimeout {
+		cfg.pingInterval = cfg.idleTimeout * 9 / 10
+	}
+
+	return cfg
+}
+
+// wsClient tracks a single websocket connection so that messages can be
+// queued for it and it can be closed with a proper close frame from outside
+// of its handler goroutine.
+type wsClient struct {
+	conn      *websocket.Conn
+	playerID  string
+	spectator bool
+	send      chan wsMessage
+	reauthed  chan time.Time
+	done      chan struct{}
+	closeOnce sync.Once
+	closeMsg  []byte
+}
+
+func newWSClient(conn *websocket.Conn, playerID string) *wsClient {
+	return &wsClient{
+		conn:     conn,
+		playerID: playerID,
+		send:     make(chan wsMessage, 16),
+		reauthed: make(chan time.Time, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// enqueue queues a message for the writer loop. It reports false when the
+// client is not keeping up and the message was dropped.
+func (c *wsClient) enqueue(message wsMessage) bool {
+	select {
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// close asks the writer loop to send a close frame with the given code and
+// shut the connection down. Only the first call has any effect.
+func (c *wsClient) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.closeMsg = websocket.FormatCloseMessage(code, reason)
+		close(c.done)
+	})
+}
+
+// closeSilently stops the writer loop without sending a close frame, which is
+// used when the peer already closed the connection or it is unusable.
+func (c *wsClient) closeSilently() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+func (s *server) registerClient(c *wsClient) bool {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+
+	if s.shuttingDown {
+		return false
+	}
+
+	s.clients[c] = struct{}{}
+	s.clientsWG.Add(1)
+	return true
+}
+
+func (s *server) unregisterClient(c *wsClient) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+
+	if _, ok := s.clients[c]; ok {
+		delete(s.clients, c)
+		s.clientsWG.Done()
+	}
+}
+
+// connectedClients returns the registered clients. Spectators watching a
+// replay are only included when withSpectators is set.
+func (s *server) connectedClients(withSpectators bool) []*wsClient {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+
+	clients := make([]*wsClient, 0, len(s.clients))
+	for c := range s.clients {
+		if !c.spectator || withSpectators {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
+
+// closeAllClients sends the optional notice followed by a close frame to
+// every connected websocket and waits until their handlers have exited or
+// the timeout elapses.
+func (s *server) closeAllClients(notice *wsMessage, code int, reason string, timeout time.Duration) {
+	s.clientsMu.Lock()
+	s.shuttingDown = true
+	clients := make([]*wsClient, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.clientsMu.Unlock()
+
+	for _, c := range clients {
+		if notice != nil {
+			c.enqueue(*notice)
+		}
+		c.close(code, reason)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		s.clientsWG.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(timeout):
+		log.Printf("timed out waiting for %d websocket(s) to close", len(clients))
+	}
+}
+
+func (s *server) handleWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, ctx, ok := s.upgradeWebsocket(w, r)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+	playerID := ctx.Value(playerIDContextKey).(string)
+
+	client := newWSClient(conn, playerID)
+	if !s.registerClient(client) {
+		s.writeClose(conn, websocket.CloseGoingAway, "server shutting down")
+		return
+	}
+	defer s.unregisterClient(client)
+
+	// The session has to be claimed before joining so that a pending removal
+	// cannot take the player out of the game right after AddPlayer.
+	query := r.URL.Query()
+	resumed := false
+	resumeToken := ""
+	if token := query.Get("resume"); token != "" {
+		var err error
+		if resumeToken, err = s.sessions.resume(token, playerID); err == nil {
+			resumed = true
+		}
+	}
+	if !resumed {
+		resumeToken = s.sessions.connect(playerID)
+	}
+	defer s.sessions.disconnect(resumeToken)
+
+	if _, err := s.ensureProfile(ctx, playerID); err != nil {
+		log.Printf("failed to load profile of %s: %v", playerID, err)
+	}
+	player, err := s.joinGame(playerID)
+	if err != nil {
+		_ = s.writeJSON(conn, map[string]string{"error": err.Error()})
+		s.writeClose(conn, websocket.CloseInternalServerErr, "failed to join game")
+		return
+	}
+
+	// Subscribing before the greeting is built means no tick can fall between
+	// the two; clients skip updates that are not newer than what they have.
+	updates, unsubscribe := s.game.Subscribe(2)
+	defer unsubscribe()
+
+	greeting := wsMessage{
+		Type:        "welcome",
+		Player:      player,
+		ResumeToken: resumeToken,
+		ChatHistory: s.chat.History(playerID),
+		Pings:       s.markers.Pings(playerID),
+		Markers:     s.markers.Markers(playerID),
+	}
+	if deltas, ok := s.resumeDeltas(resumed, query.Get("lastTick")); ok {
+		greeting.Type = "resume"
+		greeting.Deltas = deltas
+	} else {
+		greeting.Snapshot = ptrSnapshot(s.game.CurrentSnapshot())
+	}
+
+	if err := s.writeJSON(conn, greeting); err != nil {
+		log.Printf("failed to send %s: %v", greeting.Type, err)
+		return
+	}
+
+	if expiresAt, ok := tokenExpiry(ctx); ok {
+		go s.watchExpiry(client, expiresAt)
+	}
+	s.armReadDeadline(conn)
+	go s.readWebsocket(client, func(data []byte) {
+		s.handlePlayerMessage(client, data)
+	})
+
+	ping := time.NewTicker(s.ws.pingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case snapshot, ok := <-updates:
+			if !ok {
+				s.writeClose(conn, websocket.CloseGoingAway, "game closed")
+				return
+			}
+			message := wsMessage{Type: "snapshot", Snapshot: &snapshot}
+			if err := s.writeJSON(conn, message); err != nil {
+				log.Printf("failed to write snapshot: %v", err)
+				return
+			}
+		case message := <-client.send:
+			if err := s.writeJSON(conn, message); err != nil {
+				log.Printf("failed to write %s: %v", message.Type, err)
+				return
+			}
+		case <-ping.C:
+			if err := s.writePing(conn); err != nil {
+				log.Printf("failed to ping websocket for %s: %v", playerID, err)
+				return
+			}
+		case <-client.done:
+			s.finishClient(client)
+			return
+		}
+	}
+}
+
+// finishClient is called by the writer loop once the client is done. It
+// delivers queued messages and the close frame requested by close.
+func (s *server) finishClient(client *wsClient) {
+	if client.closeMsg == nil {
+		return
+	}
+	s.flushQueued(client)
+	deadline := time.Now().Add(s.ws.writeTimeout)
+	_ = client.conn.WriteControl(websocket.CloseMessage, client.closeMsg, deadline)
+}
+
+// flushQueued writes any messages still queued for the client, so that a
+// notice queued right before closing is delivered ahead of the close frame.
+func (s *server) flushQueued(client *wsClient) {
+	for {
+		select {
+		case message := <-client.send:
+			if err := s.writeJSON(client.conn, message); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// resumeDeltas returns the deltas a resuming client missed since lastTick. It
+// reports false when the client has to be sent a full snapshot instead.
+func (s *server) resumeDeltas(resumed bool, lastTick string) ([]game.SnapshotDelta, bool) {
+	if !resumed || lastTick == "" {
+		return nil, false
+	}
+
+	tick, err := strconv.ParseInt(lastTick, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	deltas, err := s.game.DeltasSince(tick)
+	if err != nil {
+		return nil, false
+	}
+	return deltas, true
+}
+
+// handlePlayerMessage dispatches a message sent by a player over the game
+// websocket. Unknown message types are ignored.
+func (s *server) handlePlayerMessage(client *wsClient, data []byte) {
+	if s.handleReauth(client, data) {
+		return
+	}
+
+	var message wsIncoming
+	if err := json.Unmarshal(data, &message); err != nil {
+		client.enqueue(wsMessage{Type: "error", Message: "invalid message"})
+		return
+	}
+	switch message.Type {
+	case "chat":
+		s.handleChat(client, message)
+	case "ping":
+		s.handlePing(client, message)
+	case "marker":
+		s.handleMarker(client, message)
+	case "removeMarker":
+		s.handleRemoveMarker(client, message)
+	case "allianceRequest":
+		s.handleAllianceRequest(client, message)
+	case "allianceAccept":
+		s.handleAllianceAnswer(client, message, true)
+	case "allianceDecline":
+		s.handleAllianceAnswer(client, message, false)
+	case "leaveTeam":
+		s.handleLeaveTeam(client)
+	case "proposeAgreement":
+		s.handleProposeAgreement(client, message)
+	case "acceptAgreement":
+		s.handleAgreementAnswer(client, message, true)
+	case "declineAgreement":
+		s.handleAgreementAnswer(client, message, false)
+	case "breakAgreement":
+		s.handleBreakAgreement(client, message)
+	}
+}
+
+// readWebsocket reads incoming messages and passes them to handle, which may
+// be nil to discard them. Reading also processes control frames (pong and
+// close), and the client is stopped when the peer goes away. Every message
+// extends the read deadline, like a pong.
+func (s *server) readWebsocket(client *wsClient, handle func(data []byte)) {
+	for {
+		_, data, err := client.conn.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			switch {
+			case errors.As(err, &netErr) && netErr.Timeout():
+				client.close(websocket.CloseGoingAway, "idle timeout")
+			default:
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					log.Printf("websocket for %s closed unexpectedly: %v", client.playerID, err)
+				}
+				client.closeSilently()
+			}
+			return
+		}
+		_ = client.conn.SetReadDeadline(time.Now().Add(s.ws.idleTimeout))
+		if handle != nil {
+			handle(data)
+		}
+	}
+}
+
+// armReadDeadline limits incoming messages and closes connections that stay
+// silent for longer than the idle timeout. Every pong, and every message read
+// by readWebsocket, extends the deadline.
+func (s *server) armReadDeadline(conn *websocket.Conn) {
+	conn.SetReadLimit(wsMaxMessageBytes)
+	_ = conn.SetReadDeadline(time.Now().Add(s.ws.idleTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(s.ws.idleTimeout))
+	})
+}
+
+func (s *server) writePing(conn *websocket.Conn) error {
+	return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.ws.writeTimeout))
+}
+
+func (s *server) writeJSON(conn *websocket.Conn, payload interface{}) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(s.ws.writeTimeout)); err != nil {
+		return err
+	}
+	return conn.WriteJSON(payload)
+}
+
+func (s *server) writeClose(conn *websocket.Conn, code int, reason string) {
+	deadline := time.Now().Add(s.ws.writeTimeout)
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadWSConfig(t *testing.T) {
+	cases := []struct {
+		name         string
+		idle, ping   string
+		wantIdle     time.Duration
+		wantInterval time.Duration
+	}{
+		{"defaults", "", "", 60 * time.Second, 25 * time.Second},
+		{"ping after the idle timeout", "10000", "20000", 10 * time.Second, 9 * time.Second},
+		{"zero idle timeout", "0", "", 60 * time.Second, 25 * time.Second},
+		{"negative idle timeout", "-5", "1000", 60 * time.Second, time.Second},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("WS_IDLE_TIMEOUT_MS", c.idle)
+			t.Setenv("WS_PING_INTERVAL_MS", c.ping)
+
+			cfg := loadWSConfig()
+			if cfg.idleTimeout != c.wantIdle || cfg.pingInterval != c.wantInterval {
+				t.Fatalf("got idle %s and ping %s, want %s and %s", cfg.idleTimeout, cfg.pingInterval, c.wantIdle, c.wantInterval)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsSubprotocol is selected when a client offers it, which lets the
+	// client pass its token as a second "bearer.<token>" protocol.
+	wsSubprotocol  = "spheres"
+	wsBearerPrefix = "bearer."
+
+	// closeAuthFailed is sent when the auth message is missing, late or
+	// carries an invalid token.
+	closeAuthFailed = 4002
+)
+
+var errNoWebsocketToken = errors.New("missing token")
+
+// withWebsocketAuth authenticates websocket requests that carry their token
+// in the Sec-WebSocket-Protocol header or, while WS_ALLOW_QUERY_TOKEN is set,
+// in the token query parameter. Requests without a token are let through and
+// have to authenticate with their first message, see upgradeWebsocket.
+func (s *server) withWebsocketAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := s.authenticateWebsocket(r)
+		if errors.Is(err, errNoWebsocketToken) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		if s.bans.has(ctx.Value(playerIDContextKey).(string)) {
+			writeError(w, http.StatusForbidden, errPlayerBanned)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (s *server) authenticateWebsocket(r *http.Request) (context.Context, error) {
+	token := ""
+	for _, protocol := range websocket.Subprotocols(r) {
+		if strings.HasPrefix(protocol, wsBearerPrefix) {
+			token = strings.TrimPrefix(protocol, wsBearerPrefix)
+		}
+	}
+	if token == "" && s.ws.allowQueryToken {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		return nil, errNoWebsocketToken
+	}
+	return s.identify(r.Context(), token)
+}
+
+// upgradeWebsocket upgrades the connection and returns the context of the
+// authenticated player. Connections that withWebsocketAuth let through
+// without a player must send {"type":"auth","token":"..."} within the auth
+// timeout. It reports false when the connection could not be set up.
+func (s *server) upgradeWebsocket(w http.ResponseWriter, r *http.Request) (*websocket.Conn, context.Context, bool) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("failed to upgrade websocket: %v", err)
+		return nil, nil, false
+	}
+
+	if _, ok := r.Context().Value(playerIDContextKey).(string); ok {
+		return conn, r.Context(), true
+	}
+
+	ctx, code, err := s.authHandshake(r.Context(), conn)
+	if err != nil {
+		s.writeClose(conn, code, err.Error())
+		conn.Close()
+		return nil, nil, false
+	}
+	return conn, ctx, true
+}
+
+func (s *server) authHandshake(base context.Context, conn *websocket.Conn) (context.Context, int, error) {
+	conn.SetReadLimit(wsMaxMessageBytes)
+	_ = conn.SetReadDeadline(time.Now().Add(s.ws.authTimeout))
+
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, closeAuthFailed, errors.New("no auth message")
+	}
+
+	var message wsIncoming
+	if err := json.Unmarshal(data, &message); err != nil || message.Type != "auth" {
+		return nil, closeAuthFailed, errors.New("first message must be auth")
+	}
+
+	ctx, err := s.identify(base, message.Token)
+	if err != nil {
+		return nil, closeAuthFailed, errors.New("invalid token")
+	}
+	if s.bans.has(ctx.Value(playerIDContextKey).(string)) {
+		return nil, websocket.ClosePolicyViolation, errPlayerBanned
+	}
+	return ctx, 0, nil
+}
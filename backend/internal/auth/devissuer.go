@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DevAudience is the aud claim of every token minted by a DevIssuer.
+	DevAudience = "spheres-dev"
+
+	DefaultDevTokenTTL = time.Hour
+	MaxDevTokenTTL     = 24 * time.Hour
+)
+
+// DevIssuer is a local token issuer for development. It signs tokens with a
+// key generated at startup, so they are checked by the Validator exactly like
+// tokens of a real provider. Tokens do not survive a restart.
+type DevIssuer struct {
+	issuer string
+	kid    string
+	key    *rsa.PrivateKey
+	jwks   json.RawMessage
+}
+
+// NewDevIssuer creates an issuer whose tokens carry issuerURL as iss.
+func NewDevIssuer(issuerURL string) (*DevIssuer, error) {
+	if issuerURL == "" {
+		return nil, errors.New("issuer URL is required")
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	kidBytes := make([]byte, 8)
+	if _, err := rand.Read(kidBytes); err != nil {
+		return nil, err
+	}
+
+	d := &DevIssuer{
+		issuer: strings.TrimSuffix(issuerURL, "/"),
+		kid:    hex.EncodeToString(kidBytes),
+		key:    key,
+	}
+	public, err := newJWK(d.kid, &key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	d.jwks, err = json.Marshal(jwksResponse{Keys: []jwk{public}})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Config trusts the issuer's tokens. The key set is inline, so the validator
+// never has to reach the issuer over HTTP.
+func (d *DevIssuer) Config() IssuerConfig {
+	return IssuerConfig{
+		Issuer:      d.issuer,
+		Audiences:   []string{DevAudience},
+		JWKS:        d.jwks,
+		GroupsClaim: "groups",
+	}
+}
+
+// DevTokenRequest describes the token to mint.
+type DevTokenRequest struct {
+	Subject string   `json:"sub"`
+	Groups  []string `json:"groups,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Email   string   `json:"email,omitempty"`
+	// TTLSeconds defaults to DefaultDevTokenTTL and is capped at
+	// MaxDevTokenTTL.
+	TTLSeconds int `json:"ttl,omitempty"`
+}
+
+// DevToken is a minted token.
+type DevToken struct {
+	Token     string    `json:"token"`
+	Subject   string    `json:"sub"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Mint signs a token for the requested subject and groups.
+func (d *DevIssuer) Mint(req DevTokenRequest) (DevToken, error) {
+	subject := strings.TrimSpace(req.Subject)
+	if subject == "" {
+		return DevToken{}, errors.New("sub is required")
+	}
+
+	ttl := DefaultDevTokenTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl > MaxDevTokenTTL {
+		ttl = MaxDevTokenTTL
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := jwt.MapClaims{
+		"iss": d.issuer,
+		"sub": subject,
+		"aud": DevAudience,
+		"iat": now.Unix(),
+		"exp": expiresAt.Unix(),
+	}
+	if len(req.Groups) > 0 {
+		claims["groups"] = req.Groups
+	}
+	if req.Name != "" {
+		claims["preferred_username"] = req.Name
+	}
+	if req.Email != "" {
+		claims["email"] = req.Email
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = d.kid
+	signed, err := token.SignedString(d.key)
+	if err != nil {
+		return DevToken{}, err
+	}
+	return DevToken{Token: signed, Subject: subject, ExpiresAt: expiresAt.Truncate(time.Second)}, nil
+}
+
+// Handler serves the discovery document, the JWKS and the token endpoint.
+// It expects to be mounted at the path of the issuer URL with that prefix
+// stripped:
+//
+//	GET  /.well-known/openid-configuration
+//	GET  /jwks.json
+//	GET  /token?sub=alice&groups=admin,moderator&ttl=3600
+//	POST /token {"sub":"alice","groups":["admin"],"ttl":3600}
+func (d *DevIssuer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeDevJSON(w, http.StatusOK, discoveryDocument{Issuer: d.issuer, JWKSURI: d.issuer + "/jwks.json"})
+	})
+	mux.HandleFunc("/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(d.jwks)
+	})
+	mux.HandleFunc("/token", d.handleToken)
+	return mux
+}
+
+func (d *DevIssuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	var req DevTokenRequest
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Subject = query.Get("sub")
+		req.Name = query.Get("name")
+		req.Email = query.Get("email")
+		for _, group := range strings.Split(query.Get("groups"), ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				req.Groups = append(req.Groups, group)
+			}
+		}
+		if ttl := query.Get("ttl"); ttl != "" {
+			seconds, err := strconv.Atoi(ttl)
+			if err != nil || seconds <= 0 {
+				writeDevJSON(w, http.StatusBadRequest, map[string]string{"error": "ttl must be a positive number of seconds"})
+				return
+			}
+			req.TTLSeconds = seconds
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			writeDevJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeDevJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	token, err := d.Mint(req)
+	if err != nil {
+		writeDevJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeDevJSON(w, http.StatusOK, token)
+}
+
+func writeDevJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(payload)
+}
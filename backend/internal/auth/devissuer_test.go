@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDevIssuerTokensValidate(t *testing.T) {
+	dev, err := NewDevIssuer("http://localhost:8080/dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewValidator(context.Background(), "cognito:groups", dev.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := dev.Mint(DevTokenRequest{Subject: "alice", Groups: []string{"admin"}, Name: "Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := v.Validate(token.Token)
+	if err != nil {
+		t.Fatalf("dev token rejected: %v", err)
+	}
+	if identity.Subject != "alice" || len(identity.Groups) != 1 || identity.Groups[0] != "admin" {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+	if identity.Claims["preferred_username"] != "Alice" {
+		t.Fatalf("expected name claim, got %v", identity.Claims["preferred_username"])
+	}
+
+	// A different dev issuer has a different key.
+	other, err := NewDevIssuer("http://localhost:8080/dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := other.Mint(DevTokenRequest{Subject: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Validate(forged.Token); err == nil {
+		t.Fatalf("token of another dev issuer must be rejected")
+	}
+
+	if _, err := dev.Mint(DevTokenRequest{}); err == nil {
+		t.Fatalf("expected an error without a subject")
+	}
+}
+
+func TestDevIssuerHandler(t *testing.T) {
+	var dev *DevIssuer
+	server := httptest.NewServer(http.StripPrefix("/dev", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dev.Handler().ServeHTTP(w, r)
+	})))
+	defer server.Close()
+
+	var err error
+	dev, err = NewDevIssuer(server.URL + "/dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Discovery works against the served endpoints just like a real provider.
+	v, err := NewValidator(context.Background(), "groups", IssuerConfig{Issuer: server.URL + "/dev"})
+	if err != nil {
+		t.Fatalf("discovery against dev issuer failed: %v", err)
+	}
+
+	resp, err := http.Get(server.URL + "/dev/token?sub=bob&groups=moderator,beta&ttl=60")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var token DevToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		t.Fatal(err)
+	}
+	identity, err := v.Validate(token.Token)
+	if err != nil {
+		t.Fatalf("minted token rejected: %v", err)
+	}
+	if identity.Subject != "bob" || len(identity.Groups) != 2 {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+
+	missing, err := http.Get(server.URL + "/dev/token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing.Body.Close()
+	if missing.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 without sub, got %d", missing.StatusCode)
+	}
+}
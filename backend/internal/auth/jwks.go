@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+type jwksResponse struct {
+	Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type discoveryDocument struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// discoverJWKS reads the JWKS location from the issuer's OpenID Connect
+// discovery document.
+func discoverJWKS(ctx context.Context, client *http.Client, issuerURL string) (string, error) {
+	url := strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
+
+	var doc discoveryDocument
+	if err := getJSON(ctx, client, url, &doc); err != nil {
+		return "", err
+	}
+	if doc.Issuer != issuerURL {
+		return "", fmt.Errorf("discovery document is for issuer %q", doc.Issuer)
+	}
+	if doc.JWKSURI == "" {
+		return "", errors.New("discovery document has no jwks_uri")
+	}
+	return doc.JWKSURI, nil
+}
+
+func fetchJWKS(ctx context.Context, client *http.Client, url string) (map[string]crypto.PublicKey, error) {
+	var body jwksResponse
+	if err := getJSON(ctx, client, url, &body); err != nil {
+		return nil, err
+	}
+	return publicKeys(body)
+}
+
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var body jwksResponse
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	return publicKeys(body)
+}
+
+func publicKeys(body jwksResponse) (map[string]crypto.PublicKey, error) {
+	keys := make(map[string]crypto.PublicKey)
+	for _, key := range body.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		var pub crypto.PublicKey
+		var err error
+		switch key.Kty {
+		case "RSA":
+			pub, err = jwkToRSAPublicKey(key)
+		case "EC":
+			pub, err = jwkToECPublicKey(key)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", key.Kid, err)
+		}
+		keys[key.Kid] = pub
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no valid keys found in JWKS")
+	}
+	return keys, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// newJWK describes a public key as a JWK.
+func newJWK(kid string, pub crypto.PublicKey) (jwk, error) {
+	encode := base64.RawURLEncoding.EncodeToString
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return jwk{Kid: kid, Kty: "RSA", Alg: "RS256", Use: "sig", N: encode(key.N.Bytes()), E: encode(big.NewInt(int64(key.E)).Bytes())}, nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return jwk{
+			Kid: kid,
+			Kty: "EC",
+			Use: "sig",
+			Crv: key.Curve.Params().Name,
+			X:   encode(key.X.FillBytes(make([]byte, size))),
+			Y:   encode(key.Y.FillBytes(make([]byte, size))),
+		}, nil
+	default:
+		return jwk{}, fmt.Errorf("unsupported key type %T", pub)
+	}
+}
+
+func jwkToRSAPublicKey(key jwk) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode modulus: %w", err)
+	}
+
+	eBytes, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode exponent: %w", err)
+	}
+
+	exp := 0
+	for _, b := range eBytes {
+		exp = exp<<8 | int(b)
+	}
+	if exp == 0 {
+		return nil, errors.New("invalid exponent in jwk")
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nBytes),
+		E: exp,
+	}, nil
+}
+
+func jwkToECPublicKey(key jwk) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch key.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", key.Crv)
+	}
+
+	xBytes, err := base64.RawURLEncoding.DecodeString(key.X)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode x: %w", err)
+	}
+	yBytes, err := base64.RawURLEncoding.DecodeString(key.Y)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode y: %w", err)
+	}
+
+	pub := &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(xBytes),
+		Y:     new(big.Int).SetBytes(yBytes),
+	}
+	if !curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, errors.New("point is not on the curve")
+	}
+	return pub, nil
+}
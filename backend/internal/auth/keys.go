@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RefreshPolicy controls how signing keys are kept up to date.
+type RefreshPolicy struct {
+	// Interval is how often keys are refreshed in the background. Every
+	// wait is jittered by up to a tenth so that replicas do not hit the
+	// issuer at the same moment.
+	Interval time.Duration
+	// MinInterval limits refreshes triggered by tokens with an unknown kid,
+	// and is also the retry delay after a failed refresh.
+	MinInterval time.Duration
+	// Retention keeps keys that disappeared from the JWKS valid for this
+	// long, so tokens signed before a rotation keep working.
+	Retention time.Duration
+}
+
+var DefaultRefreshPolicy = RefreshPolicy{
+	Interval:    time.Hour,
+	MinInterval: time.Minute,
+	Retention:   time.Hour,
+}
+
+type issuer struct {
+	config IssuerConfig
+
+	// refreshMu serialises refreshes so that concurrent unknown kids cause
+	// a single fetch.
+	refreshMu sync.Mutex
+
+	mu          sync.RWMutex
+	keys        map[string]cachedKey
+	lastRefresh time.Time
+	lastAttempt time.Time
+	lastErr     error
+}
+
+type cachedKey struct {
+	key crypto.PublicKey
+	// retiredAt is when the key was last seen in the JWKS; zero while it is
+	// still published.
+	retiredAt time.Time
+}
+
+// source names where the issuer's keys come from.
+func (iss *issuer) source() string {
+	switch {
+	case len(iss.config.JWKS) > 0:
+		return "inline"
+	case iss.config.JWKSFile != "":
+		return "file"
+	default:
+		return "url"
+	}
+}
+
+// SetRefreshPolicy replaces the refresh policy. Zero fields keep their
+// current value. It must be called before Start.
+func (v *Validator) SetRefreshPolicy(policy RefreshPolicy) {
+	if policy.Interval > 0 {
+		v.policy.Interval = policy.Interval
+	}
+	if policy.MinInterval > 0 {
+		v.policy.MinInterval = policy.MinInterval
+	}
+	if policy.Retention > 0 {
+		v.policy.Retention = policy.Retention
+	}
+}
+
+// Start refreshes the keys of every issuer in the background until ctx is
+// cancelled. Inline key sets never change and are skipped.
+func (v *Validator) Start(ctx context.Context) {
+	for _, iss := range v.issuers {
+		if iss.source() == "inline" {
+			continue
+		}
+		go v.refreshLoop(ctx, iss)
+	}
+}
+
+func (v *Validator) refreshLoop(ctx context.Context, iss *issuer) {
+	for {
+		wait := jitter(v.policy.Interval)
+		iss.mu.RLock()
+		if iss.lastErr != nil {
+			wait = v.policy.MinInterval
+		}
+		iss.mu.RUnlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		v.refresh(ctx, iss, 0)
+	}
+}
+
+func jitter(d time.Duration) time.Duration {
+	spread := int64(d / 10)
+	if spread <= 0 {
+		return d
+	}
+	return d - time.Duration(spread) + time.Duration(rand.Int64N(2*spread+1))
+}
+
+func (v *Validator) keyForKid(iss *issuer, kid string) (crypto.PublicKey, error) {
+	if key, ok := iss.key(kid); ok {
+		return key, nil
+	}
+
+	// The issuer may have rotated since the last refresh. Bogus kids must
+	// not turn into a fetch per token, so this is rate limited.
+	if err := v.refresh(context.Background(), iss, v.policy.MinInterval); err != nil {
+		return nil, err
+	}
+	if key, ok := iss.key(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id: %s", kid)
+}
+
+func (iss *issuer) key(kid string) (crypto.PublicKey, bool) {
+	iss.mu.RLock()
+	defer iss.mu.RUnlock()
+	cached, ok := iss.keys[kid]
+	return cached.key, ok
+}
+
+// refresh reloads the issuer's keys unless the last attempt was less than
+// minInterval ago. Keys missing from the new set are retained for
+// policy.Retention. A failed refresh keeps the current keys.
+func (v *Validator) refresh(ctx context.Context, iss *issuer, minInterval time.Duration) error {
+	iss.refreshMu.Lock()
+	defer iss.refreshMu.Unlock()
+
+	iss.mu.RLock()
+	recent := time.Since(iss.lastAttempt) < minInterval
+	iss.mu.RUnlock()
+	if recent {
+		return nil
+	}
+
+	keys, err := v.loadKeys(ctx, iss.config)
+	now := time.Now()
+
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+
+	iss.lastAttempt = now
+	iss.lastErr = err
+	if err != nil {
+		return err
+	}
+
+	merged := make(map[string]cachedKey, len(keys))
+	for kid, key := range keys {
+		merged[kid] = cachedKey{key: key}
+	}
+	for kid, old := range iss.keys {
+		if _, ok := merged[kid]; ok {
+			continue
+		}
+		if old.retiredAt.IsZero() {
+			old.retiredAt = now
+		}
+		if now.Sub(old.retiredAt) < v.policy.Retention {
+			merged[kid] = old
+		}
+	}
+	iss.keys = merged
+	iss.lastRefresh = now
+	return nil
+}
+
+func (v *Validator) loadKeys(ctx context.Context, cfg IssuerConfig) (map[string]crypto.PublicKey, error) {
+	switch {
+	case len(cfg.JWKS) > 0:
+		return parseJWKS(cfg.JWKS)
+	case cfg.JWKSFile != "":
+		data, err := os.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		return parseJWKS(data)
+	default:
+		return fetchJWKS(ctx, v.client, cfg.JWKSURL)
+	}
+}
+
+// KeyStatus reports how fresh an issuer's signing keys are.
+type KeyStatus struct {
+	Issuer      string    `json:"issuer"`
+	Source      string    `json:"source"`
+	Keys        int       `json:"keys"`
+	RetiredKeys int       `json:"retiredKeys"`
+	LastRefresh time.Time `json:"lastRefresh"`
+	LastError   string    `json:"lastError,omitempty"`
+	// Stale is set when refreshing has failed for more than two intervals.
+	// Cached keys are still used.
+	Stale bool `json:"stale"`
+}
+
+// KeyStatus returns the key status of every issuer, ordered by issuer.
+func (v *Validator) KeyStatus() []KeyStatus {
+	statuses := make([]KeyStatus, 0, len(v.issuers))
+	for _, iss := range v.issuers {
+		iss.mu.RLock()
+		status := KeyStatus{
+			Issuer:      iss.config.Issuer,
+			Source:      iss.source(),
+			LastRefresh: iss.lastRefresh,
+		}
+		for _, cached := range iss.keys {
+			if cached.retiredAt.IsZero() {
+				status.Keys++
+			} else {
+				status.RetiredKeys++
+			}
+		}
+		if iss.lastErr != nil {
+			status.LastError = iss.lastErr.Error()
+		}
+		status.Stale = status.Source != "inline" && time.Since(iss.lastRefresh) > 2*v.policy.Interval
+		iss.mu.RUnlock()
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Issuer < statuses[j].Issuer })
+	return statuses
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func signWith(t *testing.T, issuerURL, kid string, key *rsa.PrivateKey) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": issuerURL,
+		"sub": "alice",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestValidatorKeyRotation(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	var mu sync.Mutex
+	published := []jwk{publicJWK("old", &oldKey.PublicKey)}
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		mu.Lock()
+		defer mu.Unlock()
+		json.NewEncoder(w).Encode(jwksResponse{Keys: published})
+	}))
+	defer server.Close()
+
+	v, err := NewValidator(context.Background(), "groups", IssuerConfig{Issuer: "https://issuer.test", JWKSURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.SetRefreshPolicy(RefreshPolicy{MinInterval: time.Hour})
+	iss := v.issuers["https://issuer.test"]
+
+	mu.Lock()
+	published = []jwk{publicJWK("new", &newKey.PublicKey)}
+	mu.Unlock()
+
+	// The initial load just happened, so the unknown kid may not refresh yet.
+	newToken := signWith(t, "https://issuer.test", "new", newKey)
+	if _, err := v.Validate(newToken); err == nil {
+		t.Fatalf("expected the refresh to be rate limited")
+	}
+	if fetches.Load() != 1 {
+		t.Fatalf("expected 1 fetch, got %d", fetches.Load())
+	}
+
+	iss.mu.Lock()
+	iss.lastAttempt = time.Time{}
+	iss.mu.Unlock()
+	if _, err := v.Validate(newToken); err != nil {
+		t.Fatalf("rotated key rejected: %v", err)
+	}
+	if _, err := v.Validate(signWith(t, "https://issuer.test", "old", oldKey)); err != nil {
+		t.Fatalf("retired key must stay valid during retention: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		v.Validate(signWith(t, "https://issuer.test", "bogus", oldKey))
+	}
+	if fetches.Load() != 2 {
+		t.Fatalf("unknown kids must not cause more fetches, got %d", fetches.Load())
+	}
+
+	status := v.KeyStatus()
+	if len(status) != 1 || status[0].Keys != 1 || status[0].RetiredKeys != 1 || status[0].Stale {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	// Once retention has passed the old key is dropped.
+	iss.mu.Lock()
+	old := iss.keys["old"]
+	old.retiredAt = time.Now().Add(-2 * time.Hour)
+	iss.keys["old"] = old
+	iss.mu.Unlock()
+	if err := v.refresh(context.Background(), iss, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := iss.key("old"); ok {
+		t.Fatalf("expected the old key to be dropped after retention")
+	}
+}
+
+func TestValidatorFailedRefreshKeepsKeys(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(jwksResponse{Keys: []jwk{publicJWK("k1", &key.PublicKey)}})
+	}))
+	defer server.Close()
+
+	v, err := NewValidator(context.Background(), "groups", IssuerConfig{Issuer: "https://issuer.test", JWKSURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing.Store(true)
+	if err := v.refresh(context.Background(), v.issuers["https://issuer.test"], 0); err == nil {
+		t.Fatalf("expected the refresh to fail")
+	}
+	if _, err := v.Validate(signWith(t, "https://issuer.test", "k1", key)); err != nil {
+		t.Fatalf("cached key must survive a failed refresh: %v", err)
+	}
+	if status := v.KeyStatus(); status[0].LastError == "" {
+		t.Fatalf("expected the error in the status, got %+v", status[0])
+	}
+}
+
+func TestValidatorLoadsJWKSFile(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	data, _ := json.Marshal(jwksResponse{Keys: []jwk{publicJWK("file-key", &key.PublicKey)}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// No discovery happens, so the issuer does not need to be reachable.
+	v, err := NewValidator(context.Background(), "groups", IssuerConfig{Issuer: "https://offline.test", JWKSFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Validate(signWith(t, "https://offline.test", "file-key", key)); err != nil {
+		t.Fatalf("token rejected: %v", err)
+	}
+	if status := v.KeyStatus(); status[0].Source != "file" {
+		t.Fatalf("expected file source, got %q", status[0].Source)
+	}
+}
+
+func TestJitterStaysWithinTenPercent(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if d := jitter(time.Hour); d < 54*time.Minute || d > 66*time.Minute {
+			t.Fatalf("jittered interval %s out of range", d)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import "strings"
+
+// Role is what an authenticated user is allowed to do. Every role includes
+// the permissions of the roles below it.
+type Role string
+
+const (
+	RolePlayer    Role = "player"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var roleRank = map[Role]int{
+	RolePlayer:    0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+// ParseRole returns the role with the given name. Unknown names are not a
+// role and report false.
+func ParseRole(name string) (Role, bool) {
+	role := Role(strings.ToLower(strings.TrimSpace(name)))
+	_, ok := roleRank[role]
+	return role, ok
+}
+
+// AtLeast reports whether r grants everything min does.
+func (r Role) AtLeast(min Role) bool {
+	return roleRank[r] >= roleRank[min]
+}
+
+// RoleMapper maps a user's groups to a role.
+type RoleMapper struct {
+	Groups map[string]Role
+}
+
+// NewRoleMapper builds a mapper that grants admin to members of any of
+// adminGroups and moderator to members of any of moderatorGroups.
+func NewRoleMapper(adminGroups, moderatorGroups []string) RoleMapper {
+	m := RoleMapper{Groups: make(map[string]Role)}
+	for _, group := range moderatorGroups {
+		m.Groups[group] = RoleModerator
+	}
+	for _, group := range adminGroups {
+		m.Groups[group] = RoleAdmin
+	}
+	return m
+}
+
+// Role returns the highest role granted by the groups. Users without a
+// matching group are players.
+func (m RoleMapper) Role(groups []string) Role {
+	role := RolePlayer
+	for _, group := range groups {
+		if granted, ok := m.Groups[group]; ok && granted.AtLeast(role) {
+			role = granted
+		}
+	}
+	return role
+}
@@ -0,0 +1,38 @@
+package auth
+
+import "testing"
+
+func TestRoleMapperPicksHighestRole(t *testing.T) {
+	mapper := NewRoleMapper([]string{"ops"}, []string{"mods", "helpers"})
+
+	cases := []struct {
+		name   string
+		groups []string
+		want   Role
+	}{
+		{"no groups", nil, RolePlayer},
+		{"unknown group", []string{"beta"}, RolePlayer},
+		{"moderator", []string{"beta", "helpers"}, RoleModerator},
+		{"admin wins", []string{"mods", "ops"}, RoleAdmin},
+	}
+	for _, tc := range cases {
+		if got := mapper.Role(tc.groups); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestRoleOrdering(t *testing.T) {
+	if !RoleAdmin.AtLeast(RoleModerator) || !RoleModerator.AtLeast(RolePlayer) {
+		t.Fatalf("higher roles must include lower ones")
+	}
+	if RolePlayer.AtLeast(RoleModerator) {
+		t.Fatalf("players must not count as moderators")
+	}
+	if _, ok := ParseRole("superuser"); ok {
+		t.Fatalf("unknown role names must be rejected")
+	}
+	if role, ok := ParseRole(" Admin "); !ok || role != RoleAdmin {
+		t.Fatalf("expected admin, got %q", role)
+	}
+}
@@ -2,202 +2,228 @@ package auth
 
 import (
 	"context"
-	"crypto/rsa"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math/big"
 	"net/http"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var ErrInvalidToken = errors.New("invalid token")
+var (
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrUnknownIssuer = errors.New("token issuer is not trusted")
+)
 
-// Validator validates Cognito JWTs using the JWKS endpoint.
-type Validator struct {
-	issuer       string
-	audience     string
-	jwksURL      string
-	client       *http.Client
-	mu           sync.RWMutex
-	keys         map[string]*rsa.PublicKey
-	lastRefresh  time.Time
-	refreshEvery time.Duration
+// signingMethods are the algorithms accepted from any issuer. The key type of
+// the matching JWK has to fit the algorithm as well.
+var signingMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384"}
+
+// IssuerConfig describes one trusted OpenID Connect provider.
+type IssuerConfig struct {
+	// Issuer must match the iss claim exactly, e.g.
+	// "https://example.eu.auth0.com/".
+	Issuer string `json:"issuer"`
+	// Audiences lists the accepted aud values. Empty accepts any audience.
+	Audiences []string `json:"audiences,omitempty"`
+	// JWKSURL skips discovery when set.
+	JWKSURL string `json:"jwksUrl,omitempty"`
+	// JWKS is an inline key set used instead of fetching keys at all.
+	JWKS json.RawMessage `json:"jwks,omitempty"`
+	// JWKSFile reads the key set from a file instead of fetching it, for
+	// deployments without access to the issuer. The file is re-read on
+	// every refresh.
+	JWKSFile string `json:"jwksFile,omitempty"`
+	// SubjectClaim identifies the player; defaults to "sub".
+	SubjectClaim string `json:"subjectClaim,omitempty"`
+	// GroupsClaim lists the user's groups, e.g. "cognito:groups" or
+	// "realm_access.roles". Defaults to the validator's groups claim.
+	GroupsClaim string `json:"groupsClaim,omitempty"`
+	// SubjectPrefix is prepended to subjects so that users of different
+	// issuers cannot end up with the same player id.
+	SubjectPrefix string `json:"subjectPrefix,omitempty"`
 }
 
-type jwksResponse struct {
-	Keys []jwk `json:"keys"`
+// Cognito returns the issuer config for an AWS Cognito user pool.
+func Cognito(region, userPoolID, clientID string) IssuerConfig {
+	cfg := IssuerConfig{
+		Issuer:      fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", region, userPoolID),
+		GroupsClaim: "cognito:groups",
+	}
+	if clientID != "" {
+		cfg.Audiences = []string{clientID}
+	}
+	return cfg
 }
 
-type jwk struct {
-	Kid string `json:"kid"`
-	Kty string `json:"kty"`
-	Alg string `json:"alg"`
-	Use string `json:"use"`
-	N   string `json:"n"`
-	E   string `json:"e"`
+// Identity is the result of validating a token.
+type Identity struct {
+	Issuer  string
+	Subject string
+	Groups  []string
+	Claims  jwt.MapClaims
 }
 
-func NewValidator(region, userPoolID, audience string) (*Validator, error) {
-	if region == "" || userPoolID == "" {
-		return nil, errors.New("region and userPoolID are required")
-	}
+// Validator validates JWTs from any number of OpenID Connect issuers using
+// their published JWKS.
+type Validator struct {
+	client  *http.Client
+	issuers map[string]*issuer
+	policy  RefreshPolicy
+}
 
-	issuer := fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", region, userPoolID)
-	jwksURL := fmt.Sprintf("%s/.well-known/jwks.json", issuer)
+// NewValidator discovers and loads the signing keys of every issuer. Claims
+// without an issuer specific mapping read the user's groups from
+// groupsClaim.
+func NewValidator(ctx context.Context, groupsClaim string, configs ...IssuerConfig) (*Validator, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("at least one issuer is required")
+	}
 
 	v := &Validator{
-		issuer:       issuer,
-		audience:     audience,
-		jwksURL:      jwksURL,
-		client:       &http.Client{Timeout: 10 * time.Second},
-		keys:         make(map[string]*rsa.PublicKey),
-		refreshEvery: time.Hour,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		issuers: make(map[string]*issuer, len(configs)),
+		policy:  DefaultRefreshPolicy,
 	}
 
-	if err := v.refreshKeys(context.Background()); err != nil {
-		return nil, err
+	for _, cfg := range configs {
+		if cfg.Issuer == "" {
+			return nil, errors.New("issuer URL is required")
+		}
+		if cfg.SubjectClaim == "" {
+			cfg.SubjectClaim = "sub"
+		}
+		if cfg.GroupsClaim == "" {
+			cfg.GroupsClaim = groupsClaim
+		}
+		if cfg.JWKSURL == "" && len(cfg.JWKS) == 0 && cfg.JWKSFile == "" {
+			jwksURL, err := discoverJWKS(ctx, v.client, cfg.Issuer)
+			if err != nil {
+				return nil, fmt.Errorf("discover %s: %w", cfg.Issuer, err)
+			}
+			cfg.JWKSURL = jwksURL
+		}
+
+		iss := &issuer{config: cfg}
+		if err := v.refresh(ctx, iss, 0); err != nil {
+			return nil, fmt.Errorf("load keys of %s: %w", cfg.Issuer, err)
+		}
+		v.issuers[cfg.Issuer] = iss
 	}
 
 	return v, nil
 }
 
-func (v *Validator) Validate(tokenString string) (*jwt.Token, jwt.MapClaims, error) {
+func (v *Validator) Validate(tokenString string) (Identity, error) {
 	if tokenString == "" {
-		return nil, nil, ErrInvalidToken
+		return Identity{}, ErrInvalidToken
+	}
+
+	// The issuer decides which keys and rules apply, so it has to be read
+	// before the signature can be checked.
+	unverified := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, unverified); err != nil {
+		return Identity{}, ErrInvalidToken
+	}
+	issuerURL, _ := unverified["iss"].(string)
+	iss, ok := v.issuers[issuerURL]
+	if !ok {
+		return Identity{}, ErrUnknownIssuer
 	}
 
 	keyFunc := func(token *jwt.Token) (interface{}, error) {
-		kidValue, ok := token.Header["kid"].(string)
+		kid, ok := token.Header["kid"].(string)
 		if !ok {
 			return nil, ErrInvalidToken
 		}
-
-		key, err := v.keyForKid(kidValue)
-		if err != nil {
-			return nil, err
-		}
-
-		return key, nil
+		return v.keyForKid(iss, kid)
 	}
 
-	opts := []jwt.ParserOption{jwt.WithIssuer(v.issuer)}
-	if v.audience != "" {
-		opts = append(opts, jwt.WithAudience(v.audience))
-	}
-
-	token, err := jwt.Parse(tokenString, keyFunc, opts...)
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyFunc,
+		jwt.WithIssuer(iss.config.Issuer),
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
-		return nil, nil, err
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
-		return nil, nil, ErrInvalidToken
+		return Identity{}, err
 	}
-
-	return token, claims, nil
-}
-
-func (v *Validator) keyForKid(kid string) (*rsa.PublicKey, error) {
-	v.mu.RLock()
-	key, ok := v.keys[kid]
-	last := v.lastRefresh
-	v.mu.RUnlock()
-
-	if ok {
-		return key, nil
+	if !token.Valid {
+		return Identity{}, ErrInvalidToken
 	}
-
-	// attempt refresh if keys might be stale
-	if time.Since(last) > v.refreshEvery {
-		if err := v.refreshKeys(context.Background()); err != nil {
-			return nil, err
-		}
+	if err := checkAudience(claims, iss.config.Audiences); err != nil {
+		return Identity{}, err
 	}
 
-	v.mu.RLock()
-	defer v.mu.RUnlock()
-
-	key, ok = v.keys[kid]
-	if !ok {
-		return nil, fmt.Errorf("unknown key id: %s", kid)
+	subject, _ := lookupClaim(claims, iss.config.SubjectClaim).(string)
+	if subject == "" {
+		return Identity{}, fmt.Errorf("token missing %s claim", iss.config.SubjectClaim)
 	}
 
-	return key, nil
+	return Identity{
+		Issuer:  iss.config.Issuer,
+		Subject: iss.config.SubjectPrefix + subject,
+		Groups:  claimStrings(lookupClaim(claims, iss.config.GroupsClaim)),
+		Claims:  claims,
+	}, nil
 }
 
-func (v *Validator) refreshKeys(ctx context.Context) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.jwksURL, nil)
-	if err != nil {
-		return err
+func checkAudience(claims jwt.MapClaims, accepted []string) error {
+	if len(accepted) == 0 {
+		return nil
 	}
-
-	resp, err := v.client.Do(req)
+	audiences, err := claims.GetAudience()
 	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to fetch jwks: %s", resp.Status)
+		return ErrInvalidToken
 	}
-
-	var body jwksResponse
-	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
-		return err
-	}
-
-	keys := make(map[string]*rsa.PublicKey)
-	for _, key := range body.Keys {
-		if key.Kty != "RSA" {
-			continue
-		}
-		pub, err := jwkToPublicKey(key)
-		if err != nil {
-			return err
+	for _, aud := range audiences {
+		for _, want := range accepted {
+			if aud == want {
+				return nil
+			}
 		}
-		keys[key.Kid] = pub
 	}
-
-	if len(keys) == 0 {
-		return errors.New("no valid keys found in JWKS")
-	}
-
-	v.mu.Lock()
-	defer v.mu.Unlock()
-
-	v.keys = keys
-	v.lastRefresh = time.Now()
-
-	return nil
+	return jwt.ErrTokenInvalidAudience
 }
 
-func jwkToPublicKey(key jwk) (*rsa.PublicKey, error) {
-	nBytes, err := base64.RawURLEncoding.DecodeString(key.N)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode modulus: %w", err)
+// lookupClaim returns the claim with the given name. Names that do not exist
+// as a top level claim are treated as a dotted path into nested objects,
+// which is how Keycloak exposes roles ("realm_access.roles").
+func lookupClaim(claims jwt.MapClaims, name string) interface{} {
+	if value, ok := claims[name]; ok || name == "" {
+		return value
 	}
 
-	eBytes, err := base64.RawURLEncoding.DecodeString(key.E)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode exponent: %w", err)
+	var value interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(name, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[part]
 	}
+	return value
+}
 
-	exp := 0
-	for _, b := range eBytes {
-		exp = exp<<8 | int(b)
-	}
-	if exp == 0 {
-		return nil, errors.New("invalid exponent in jwk")
+// claimStrings accepts the shapes string claims come in: a JSON array or a
+// single string with comma or space separated values.
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	case []string:
+		return v
+	case string:
+		return strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	default:
+		return nil
 	}
-
-	return &rsa.PublicKey{
-		N: new(big.Int).SetBytes(nBytes),
-		E: exp,
-	}, nil
 }
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIssuer serves a discovery document and a JWKS with a single key.
+type testIssuer struct {
+	server *httptest.Server
+	kid    string
+	key    crypto.Signer
+	method jwt.SigningMethod
+}
+
+func newTestIssuer(t *testing.T, kid string, key crypto.Signer, method jwt.SigningMethod) *testIssuer {
+	t.Helper()
+	iss := &testIssuer{kid: kid, key: key, method: method}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(discoveryDocument{Issuer: iss.url(), JWKSURI: iss.url() + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jwksResponse{Keys: []jwk{publicJWK(kid, key.Public())}})
+	})
+	iss.server = httptest.NewServer(mux)
+	t.Cleanup(iss.server.Close)
+	return iss
+}
+
+func (i *testIssuer) url() string {
+	return i.server.URL
+}
+
+func (i *testIssuer) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	if _, ok := claims["iss"]; !ok {
+		claims["iss"] = i.url()
+	}
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+	token := jwt.NewWithClaims(i.method, claims)
+	token.Header["kid"] = i.kid
+	signed, err := token.SignedString(i.key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func publicJWK(kid string, pub crypto.PublicKey) jwk {
+	key, err := newJWK(kid, pub)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func TestValidatorAcceptsMultipleIssuers(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keycloak := newTestIssuer(t, "rsa-1", rsaKey, jwt.SigningMethodRS256)
+	auth0 := newTestIssuer(t, "ec-1", ecKey, jwt.SigningMethodES256)
+
+	v, err := NewValidator(context.Background(), "groups",
+		IssuerConfig{Issuer: keycloak.url(), Audiences: []string{"game"}, GroupsClaim: "realm_access.roles"},
+		IssuerConfig{Issuer: auth0.url(), SubjectClaim: "email", SubjectPrefix: "auth0|"},
+	)
+	if err != nil {
+		t.Fatalf("failed to create validator: %v", err)
+	}
+
+	identity, err := v.Validate(keycloak.sign(t, jwt.MapClaims{
+		"sub":          "kc-user",
+		"aud":          "game",
+		"realm_access": map[string]interface{}{"roles": []interface{}{"admin"}},
+	}))
+	if err != nil {
+		t.Fatalf("rsa token rejected: %v", err)
+	}
+	if identity.Subject != "kc-user" || len(identity.Groups) != 1 || identity.Groups[0] != "admin" {
+		t.Fatalf("unexpected identity: %+v", identity)
+	}
+
+	identity, err = v.Validate(auth0.sign(t, jwt.MapClaims{"sub": "ignored", "email": "a@example.com", "groups": "mods"}))
+	if err != nil {
+		t.Fatalf("es256 token rejected: %v", err)
+	}
+	if identity.Subject != "auth0|a@example.com" || len(identity.Groups) != 1 || identity.Groups[0] != "mods" {
+		t.Fatalf("unexpected identity: %+v", identity)
+	}
+
+	if _, err := v.Validate(keycloak.sign(t, jwt.MapClaims{"sub": "kc-user", "aud": "other"})); !errors.Is(err, jwt.ErrTokenInvalidAudience) {
+		t.Fatalf("expected audience error, got %v", err)
+	}
+	if _, err := v.Validate(keycloak.sign(t, jwt.MapClaims{"sub": "kc-user", "aud": "game", "iss": "https://evil.example"})); !errors.Is(err, ErrUnknownIssuer) {
+		t.Fatalf("expected unknown issuer, got %v", err)
+	}
+	if _, err := v.Validate(keycloak.sign(t, jwt.MapClaims{"sub": "kc-user", "aud": "game", "exp": time.Now().Add(-time.Minute).Unix()})); err == nil {
+		t.Fatalf("expected expired token to be rejected")
+	}
+
+	// A token claiming one issuer but signed with another issuer's key.
+	forged := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": keycloak.url(), "sub": "kc-user", "aud": "game", "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	forged.Header["kid"] = "rsa-1"
+	signed, err := forged.SignedString(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Validate(signed); err == nil {
+		t.Fatalf("expected a token signed with the wrong key to be rejected")
+	}
+}
+
+func TestValidatorRejectsMismatchedDiscovery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(discoveryDocument{Issuer: "https://someone-else.example", JWKSURI: "https://someone-else.example/keys"})
+	}))
+	defer server.Close()
+
+	if _, err := NewValidator(context.Background(), "groups", IssuerConfig{Issuer: server.URL}); err == nil {
+		t.Fatalf("expected discovery for a different issuer to fail")
+	}
+}
@@ -0,0 +1,280 @@
+// Package chat keeps the in-game chat: who may post, who may read what, and
+// a bounded history for players who join later.
+package chat
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+type Channel string
+
+const (
+	ChannelGlobal Channel = "global"
+	ChannelTeam   Channel = "team"
+	ChannelDirect Channel = "direct"
+)
+
+var (
+	ErrEmpty          = errors.New("message is empty")
+	ErrTooLong        = errors.New("message is too long")
+	ErrRateLimited    = errors.New("you are sending messages too quickly")
+	ErrMuted          = errors.New("you are muted")
+	ErrNoTeam         = errors.New("you are not on a team")
+	ErrNoRecipient    = errors.New("direct messages need a recipient")
+	ErrUnknownChannel = errors.New("unknown chat channel")
+	ErrMuteTooLong    = errors.New("mute is too long")
+)
+
+// Config limits what players can post.
+type Config struct {
+	// HistorySize is how many messages are kept for players who join later.
+	HistorySize int
+	// MaxLength is the longest message in characters.
+	MaxLength int
+	// RateLimit messages may be sent per RateWindow.
+	RateLimit  int
+	RateWindow time.Duration
+	// DefaultMute is how long a mute lasts when no length is given, and
+	// MaxMute the longest mute allowed.
+	DefaultMute time.Duration
+	MaxMute     time.Duration
+}
+
+var DefaultConfig = Config{
+	HistorySize: 100,
+	MaxLength:   280,
+	RateLimit:   5,
+	RateWindow:  10 * time.Second,
+	DefaultMute: 10 * time.Minute,
+	MaxMute:     30 * 24 * time.Hour,
+}
+
+// Message is a chat message. Team is set for team messages and To for direct
+// messages.
+type Message struct {
+	ID       string    `json:"id"`
+	Channel  Channel   `json:"channel"`
+	From     string    `json:"from"`
+	FromName string    `json:"fromName,omitempty"`
+	To       string    `json:"to,omitempty"`
+	Team     string    `json:"team,omitempty"`
+	Text     string    `json:"text"`
+	SentAt   time.Time `json:"sentAt"`
+	Deleted  bool      `json:"deleted,omitempty"`
+}
+
+// TeamOf returns the team of a player, or "" when they are not on one.
+type TeamOf func(playerID string) string
+
+// Hub validates, stores and routes messages. It does not deliver them; the
+// caller sends each message to every player VisibleTo reports.
+type Hub struct {
+	mu      sync.Mutex
+	config  Config
+	teamOf  TeamOf
+	history []Message
+	nextID  int64
+	sent    map[string][]time.Time
+	mutes   map[string]time.Time
+	pruned  time.Time
+	now     func() time.Time
+}
+
+// NewHub creates a hub. teamOf may be nil while there are no teams, which
+// leaves team chat unavailable.
+func NewHub(config Config, teamOf TeamOf) *Hub {
+	if teamOf == nil {
+		teamOf = func(string) string { return "" }
+	}
+	return &Hub{
+		config: config,
+		teamOf: teamOf,
+		sent:   make(map[string][]time.Time),
+		mutes:  make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// Post checks and stores a message from a player. fromName is shown next to
+// the message and to is the recipient of direct messages.
+func (h *Hub) Post(from, fromName string, channel Channel, to, text string) (Message, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return Message{}, ErrEmpty
+	case utf8.RuneCountInString(text) > h.config.MaxLength:
+		return Message{}, ErrTooLong
+	}
+
+	message := Message{Channel: channel, From: from, FromName: fromName, Text: text}
+	switch channel {
+	case ChannelGlobal:
+	case ChannelTeam:
+		if message.Team = h.teamOf(from); message.Team == "" {
+			return Message{}, ErrNoTeam
+		}
+	case ChannelDirect:
+		if to == "" || to == from {
+			return Message{}, ErrNoRecipient
+		}
+		message.To = to
+	default:
+		return Message{}, ErrUnknownChannel
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	h.pruneLocked(now)
+	if until, ok := h.mutes[from]; ok {
+		if now.Before(until) {
+			return Message{}, ErrMuted
+		}
+		delete(h.mutes, from)
+	}
+	if !h.allowLocked(from, now) {
+		return Message{}, ErrRateLimited
+	}
+
+	h.nextID++
+	message.ID = strconv.FormatInt(h.nextID, 10)
+	message.SentAt = now.UTC()
+	h.history = append(h.history, message)
+	if over := len(h.history) - h.config.HistorySize; over > 0 {
+		h.history = append([]Message(nil), h.history[over:]...)
+	}
+	return message, nil
+}
+
+// allowLocked enforces the rate limit over a sliding window.
+func (h *Hub) allowLocked(playerID string, now time.Time) bool {
+	recent := h.sent[playerID][:0]
+	for _, at := range h.sent[playerID] {
+		if now.Sub(at) < h.config.RateWindow {
+			recent = append(recent, at)
+		}
+	}
+	if len(recent) >= h.config.RateLimit {
+		h.sent[playerID] = recent
+		return false
+	}
+	h.sent[playerID] = append(recent, now)
+	return true
+}
+
+// pruneLocked forgets rate limit windows and mutes that have run out, so that
+// players who posted once and left are not kept forever. It sweeps at most
+// once per rate window.
+func (h *Hub) pruneLocked(now time.Time) {
+	if now.Sub(h.pruned) < h.config.RateWindow {
+		return
+	}
+	h.pruned = now
+
+	for playerID, times := range h.sent {
+		if len(times) == 0 || now.Sub(times[len(times)-1]) >= h.config.RateWindow {
+			delete(h.sent, playerID)
+		}
+	}
+	for playerID, until := range h.mutes {
+		if !now.Before(until) {
+			delete(h.mutes, playerID)
+		}
+	}
+}
+
+// VisibleTo reports whether playerID may read the message. Team membership
+// is checked when asked, so players who switch teams only see the messages
+// of their current team.
+func (h *Hub) VisibleTo(message Message, playerID string) bool {
+	switch message.Channel {
+	case ChannelTeam:
+		return h.teamOf(playerID) == message.Team
+	case ChannelDirect:
+		return message.From == playerID || message.To == playerID
+	default:
+		return true
+	}
+}
+
+// History returns the stored messages playerID may read, oldest first.
+func (h *Hub) History(playerID string) []Message {
+	h.mu.Lock()
+	history := append([]Message(nil), h.history...)
+	h.mu.Unlock()
+
+	visible := make([]Message, 0, len(history))
+	for _, message := range history {
+		if h.VisibleTo(message, playerID) {
+			visible = append(visible, message)
+		}
+	}
+	return visible
+}
+
+// Delete removes a message from the history and returns it with its text
+// cleared, so that clients can drop it as well.
+func (h *Hub) Delete(id string) (Message, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, message := range h.history {
+		if message.ID == id {
+			h.history = append(h.history[:i], h.history[i+1:]...)
+			message.Text = ""
+			message.Deleted = true
+			return message, true
+		}
+	}
+	return Message{}, false
+}
+
+// Mute stops a player from posting for d, or for DefaultMute when d is not
+// positive, and returns when the mute ends. Mutes longer than MaxMute are
+// rejected with ErrMuteTooLong.
+func (h *Hub) Mute(playerID string, d time.Duration) (time.Time, error) {
+	if d <= 0 {
+		d = h.config.DefaultMute
+	}
+	if d > h.config.MaxMute {
+		return time.Time{}, ErrMuteTooLong
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	until := h.now().Add(d).UTC()
+	h.mutes[playerID] = until
+	return until, nil
+}
+
+// Unmute lifts a mute. It reports false when the player was not muted.
+func (h *Hub) Unmute(playerID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	until, ok := h.mutes[playerID]
+	delete(h.mutes, playerID)
+	return ok && h.now().Before(until)
+}
+
+// MutedUntil returns when the player's mute ends, if they are muted.
+func (h *Hub) MutedUntil(playerID string) (time.Time, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	until, ok := h.mutes[playerID]
+	if !ok {
+		return time.Time{}, false
+	}
+	if !h.now().Before(until) {
+		delete(h.mutes, playerID)
+		return time.Time{}, false
+	}
+	return until, true
+}
@@ -0,0 +1,161 @@
+package chat
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestHub(teams map[string]string) (*Hub, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	h := NewHub(Config{HistorySize: 3, MaxLength: 10, RateLimit: 2, RateWindow: time.Second, DefaultMute: time.Minute, MaxMute: 24 * time.Hour}, func(id string) string {
+		return teams[id]
+	})
+	h.now = func() time.Time { return now }
+	return h, &now
+}
+
+func TestPostValidatesMessages(t *testing.T) {
+	h, _ := newTestHub(map[string]string{"a": "red"})
+
+	cases := []struct {
+		from    string
+		channel Channel
+		to      string
+		text    string
+		want    error
+	}{
+		{"a", ChannelGlobal, "", "   ", ErrEmpty},
+		{"a", ChannelGlobal, "", strings.Repeat("x", 11), ErrTooLong},
+		{"b", ChannelTeam, "", "hi", ErrNoTeam},
+		{"a", ChannelDirect, "", "hi", ErrNoRecipient},
+		{"a", ChannelDirect, "a", "hi", ErrNoRecipient},
+		{"a", "shout", "", "hi", ErrUnknownChannel},
+	}
+	for _, c := range cases {
+		if _, err := h.Post(c.from, "", c.channel, c.to, c.text); !errors.Is(err, c.want) {
+			t.Errorf("Post(%s, %s, %q) = %v, want %v", c.from, c.channel, c.text, err, c.want)
+		}
+	}
+	if len(h.History("a")) != 0 {
+		t.Fatal("rejected messages must not be stored")
+	}
+}
+
+func TestRateLimitAndMute(t *testing.T) {
+	h, now := newTestHub(nil)
+
+	for i := 0; i < 2; i++ {
+		if _, err := h.Post("a", "", ChannelGlobal, "", "hi"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := h.Post("a", "", ChannelGlobal, "", "hi"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	if _, err := h.Post("b", "", ChannelGlobal, "", "hi"); err != nil {
+		t.Fatalf("the limit is per player: %v", err)
+	}
+	*now = now.Add(time.Second)
+	if _, err := h.Post("a", "", ChannelGlobal, "", "hi"); err != nil {
+		t.Fatalf("the window should have passed: %v", err)
+	}
+
+	if _, err := h.Mute("a", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(time.Second)
+	if _, err := h.Post("a", "", ChannelGlobal, "", "hi"); !errors.Is(err, ErrMuted) {
+		t.Fatalf("expected ErrMuted, got %v", err)
+	}
+	*now = now.Add(time.Minute)
+	if _, ok := h.MutedUntil("a"); ok {
+		t.Fatal("the mute should have ended")
+	}
+	if _, err := h.Post("a", "", ChannelGlobal, "", "hi"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMuteLength(t *testing.T) {
+	h, now := newTestHub(nil)
+	until, err := h.Mute("a", 0)
+	if err != nil || !until.Equal(now.Add(h.config.DefaultMute)) {
+		t.Fatalf("expected the default mute, got %s, %v", until, err)
+	}
+	if _, err := h.Mute("a", h.config.MaxMute+time.Second); !errors.Is(err, ErrMuteTooLong) {
+		t.Fatalf("expected ErrMuteTooLong, got %v", err)
+	}
+	if got, _ := h.MutedUntil("a"); !got.Equal(until) {
+		t.Fatalf("expected the rejected mute to leave the earlier one, got %s", got)
+	}
+}
+
+func TestExpiredRateWindowsAndMutesArePruned(t *testing.T) {
+	h, now := newTestHub(nil)
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := h.Post(id, "", ChannelGlobal, "", "hi"); err != nil {
+			t.Fatalf("post from %s failed: %v", id, err)
+		}
+	}
+	h.Mute("b", time.Minute)
+	h.Mute("c", time.Hour)
+
+	*now = now.Add(2 * time.Minute)
+	if _, err := h.Post("a", "", ChannelGlobal, "", "hi"); err != nil {
+		t.Fatalf("post failed: %v", err)
+	}
+	if _, ok := h.sent["b"]; ok || len(h.sent) != 1 {
+		t.Fatalf("expected only a's rate window to be kept, got %v", h.sent)
+	}
+	if _, ok := h.mutes["b"]; ok || len(h.mutes) != 1 {
+		t.Fatalf("expected only c's mute to be kept, got %v", h.mutes)
+	}
+}
+
+func TestHistoryIsBoundedAndFiltered(t *testing.T) {
+	h, now := newTestHub(map[string]string{"a": "red", "b": "blue", "c": "red"})
+
+	post := func(from string, channel Channel, to, text string) Message {
+		t.Helper()
+		*now = now.Add(time.Second)
+		m, err := h.Post(from, "", channel, to, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	post("b", ChannelGlobal, "", "dropped")
+	post("a", ChannelGlobal, "", "hello")
+	team := post("a", ChannelTeam, "", "go north")
+	post("b", ChannelDirect, "c", "psst")
+
+	texts := func(playerID string) string {
+		var out []string
+		for _, m := range h.History(playerID) {
+			out = append(out, m.Text)
+		}
+		return strings.Join(out, ",")
+	}
+	if got := texts("c"); got != "hello,go north,psst" {
+		t.Fatalf("c sees %q", got)
+	}
+	if got := texts("b"); got != "hello,psst" {
+		t.Fatalf("b sees %q", got)
+	}
+	if got := texts("a"); got != "hello,go north" {
+		t.Fatalf("a sees %q", got)
+	}
+
+	deleted, ok := h.Delete(team.ID)
+	if !ok || !deleted.Deleted || deleted.Text != "" {
+		t.Fatalf("unexpected deleted message %+v", deleted)
+	}
+	if got := texts("c"); got != "hello,psst" {
+		t.Fatalf("c sees %q after delete", got)
+	}
+	if _, ok := h.Delete(team.ID); ok {
+		t.Fatal("a message can only be deleted once")
+	}
+}
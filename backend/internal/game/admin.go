@@ -0,0 +1,181 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUnknownPlayer  = errors.New("unknown player")
+	ErrOutOfBounds    = errors.New("position is out of bounds")
+	ErrTileOccupied   = errors.New("tile already holds a core or resource base")
+	ErrNoCore         = errors.New("tile does not hold a core")
+	ErrNoResourceBase = errors.New("tile is not a resource base")
+	ErrLastCore       = errors.New("cannot remove a player's last core")
+	ErrColorTaken     = errors.New("color is too close to another player's color")
+)
+
+// Reset replaces the board with a freshly seeded one of the given size under
+// the given rules and removes every player. The tick counter keeps counting
+// so that ticks stay unique across matches; any recording in progress is
+// stopped. It returns ErrUnknownSpreadRule and leaves the match alone when
+// the rules name an unknown spread rule.
+func (g *Game) Reset(width, height, resourceBases int, seed int64, rules Rules) error {
+	rules = rules.clone().normalized()
+	resolver, err := NewSpreadResolver(rules)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.width = width
+	g.height = height
+	g.players = make(map[string]*Player)
+	g.tiles = newTiles(width, height)
+	g.resourceTiles = make(map[string]bool)
+	g.resources = make(map[string]*Resource)
+	g.resourceByPos = make(map[string]string)
+	g.pendingSpreads = make(map[string]spreadBucket)
+	g.nextResourceID = 0
+	g.rules = rules
+	g.resolver = resolver
+	g.winner = nil
+	g.agreements = nil
+	g.nextAgreementID = 0
+	g.seed = seed
+	g.rand = seededStreams(seed)
+	g.recording = nil
+	g.history.Reset()
+
+	g.seedResourceTiles(resourceBases)
+	return nil
+}
+
+// PlaceCore gives an existing player an additional core.
+func (g *Game) PlaceCore(playerID string, pos Position) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	player, ok := g.players[playerID]
+	if !ok {
+		return ErrUnknownPlayer
+	}
+	if !g.isInBounds(pos) {
+		return ErrOutOfBounds
+	}
+	tile := g.tiles[posKey(pos)]
+	if tile.Type == TileCore || tile.ResourceBase {
+		return ErrTileOccupied
+	}
+
+	g.recordLocked(ReplayEvent{Kind: EventPlaceCore, PlayerID: playerID, Position: &pos})
+
+	player.CorePositions = append(player.CorePositions, pos)
+	tile.Type = TileCore
+	tile.OwnerID = playerID
+	tile.CoreBorder = true
+	return nil
+}
+
+// RemoveCore turns a core back into a normal tile that stays owned by the
+// same player. A player always keeps at least one core.
+func (g *Game) RemoveCore(pos Position) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.isInBounds(pos) {
+		return ErrOutOfBounds
+	}
+	tile := g.tiles[posKey(pos)]
+	player, ok := g.players[tile.OwnerID]
+	if tile.Type != TileCore || !ok {
+		return ErrNoCore
+	}
+	if len(player.CorePositions) <= 1 {
+		return ErrLastCore
+	}
+
+	g.recordLocked(ReplayEvent{Kind: EventRemoveCore, Position: &pos})
+
+	// Snapshots share the slice, so build a new one instead of filtering in
+	// place.
+	cores := make([]Position, 0, len(player.CorePositions)-1)
+	for _, core := range player.CorePositions {
+		if core != pos {
+			cores = append(cores, core)
+		}
+	}
+	player.CorePositions = cores
+	tile.Type = TileNormal
+	if g.resourceTiles[posKey(pos)] {
+		tile.Type = TileResource
+	}
+	tile.CoreBorder = false
+	return nil
+}
+
+// PlaceResourceBase turns a tile into a resource base that spawns resources
+// from the next tick on.
+func (g *Game) PlaceResourceBase(pos Position) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.isInBounds(pos) {
+		return ErrOutOfBounds
+	}
+	key := posKey(pos)
+	tile := g.tiles[key]
+	if tile.Type == TileCore || tile.ResourceBase {
+		return ErrTileOccupied
+	}
+
+	g.recordLocked(ReplayEvent{Kind: EventPlaceResourceBase, Position: &pos})
+
+	tile.Type = TileResource
+	tile.ResourceBase = true
+	g.resourceTiles[key] = true
+	return nil
+}
+
+// RemoveResourceBase stops a tile from spawning resources. A resource that
+// is already on the tile stays in play.
+func (g *Game) RemoveResourceBase(pos Position) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.isInBounds(pos) {
+		return ErrOutOfBounds
+	}
+	key := posKey(pos)
+	tile := g.tiles[key]
+	if !tile.ResourceBase {
+		return ErrNoResourceBase
+	}
+
+	g.recordLocked(ReplayEvent{Kind: EventRemoveResourceBase, Position: &pos})
+
+	tile.Type = TileNormal
+	tile.ResourceBase = false
+	delete(g.resourceTiles, key)
+	return nil
+}
+
+func (g *Game) applyAdminEvent(event ReplayEvent) error {
+	if event.Position == nil {
+		return fmt.Errorf("%s event without a position", event.Kind)
+	}
+	switch event.Kind {
+	case EventPlaceCore:
+		return g.PlaceCore(event.PlayerID, *event.Position)
+	case EventRemoveCore:
+		return g.RemoveCore(*event.Position)
+	case EventPlaceResourceBase:
+		return g.PlaceResourceBase(*event.Position)
+	case EventRemoveResourceBase:
+		return g.RemoveResourceBase(*event.Position)
+	default:
+		return fmt.Errorf("unknown replay event %q", event.Kind)
+	}
+}
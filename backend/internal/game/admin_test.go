@@ -0,0 +1,140 @@
+package game
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAdminEditsAreReplayed(t *testing.T) {
+	g := NewGameWithSeed(12, 12, 6, 17)
+	if _, err := g.AddPlayerAt("player-1", Position{X: 2, Y: 2}, ""); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+	if err := g.StartRecording("match-1"); err != nil {
+		t.Fatalf("failed to start recording: %v", err)
+	}
+
+	var base Position
+	var free []Position
+	for _, tile := range g.CurrentSnapshot().Tiles {
+		switch {
+		case tile.ResourceBase:
+			base = tile.Position
+		case tile.Type == TileNormal && tile.Position.X > 5:
+			free = append(free, tile.Position)
+		}
+	}
+	core, newBase := free[0], free[len(free)-1]
+
+	for i := 0; i < 12; i++ {
+		var err error
+		switch i {
+		case 2:
+			err = g.PlaceCore("player-1", core)
+		case 4:
+			err = g.RemoveResourceBase(base)
+		case 6:
+			err = g.PlaceResourceBase(newBase)
+		case 8:
+			err = g.RemoveCore(Position{X: 2, Y: 2})
+		}
+		if err != nil {
+			t.Fatalf("edit at step %d failed: %v", i, err)
+		}
+		g.Tick()
+	}
+
+	snapshot := g.CurrentSnapshot()
+	if cores := snapshot.Players["player-1"].CorePositions; len(cores) != 1 || cores[0] != core {
+		t.Fatalf("unexpected cores after edits: %+v", cores)
+	}
+
+	log, err := g.Recording()
+	if err != nil {
+		t.Fatalf("failed to read recording: %v", err)
+	}
+	if len(log.Events) != 4 {
+		t.Fatalf("expected 4 recorded edits, got %d", len(log.Events))
+	}
+	if err := VerifyReplay(log); err != nil {
+		t.Fatalf("replay of admin edits failed: %v", err)
+	}
+}
+
+func TestAdminEditValidation(t *testing.T) {
+	g := NewGameWithSeed(8, 8, 0, 3)
+	if _, err := g.AddPlayerAt("player-1", Position{X: 1, Y: 1}, ""); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"unknown player", g.PlaceCore("nobody", Position{X: 4, Y: 4}), ErrUnknownPlayer},
+		{"out of bounds", g.PlaceCore("player-1", Position{X: 8, Y: 0}), ErrOutOfBounds},
+		{"occupied", g.PlaceResourceBase(Position{X: 1, Y: 1}), ErrTileOccupied},
+		{"last core", g.RemoveCore(Position{X: 1, Y: 1}), ErrLastCore},
+		{"no core", g.RemoveCore(Position{X: 5, Y: 5}), ErrNoCore},
+		{"no base", g.RemoveResourceBase(Position{X: 5, Y: 5}), ErrNoResourceBase},
+	}
+	for _, tc := range cases {
+		if !errors.Is(tc.err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, tc.err)
+		}
+	}
+}
+
+func TestResetStartsAFreshBoard(t *testing.T) {
+	g := NewGameWithSeed(8, 8, 4, 3)
+	if _, err := g.AddPlayer("player-1"); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		g.Tick()
+	}
+
+	if err := g.Reset(10, 6, 3, 9, Rules{SpreadRule: SpreadDistance, SupplyGraceTicks: 4}); err != nil {
+		t.Fatalf("failed to reset: %v", err)
+	}
+
+	snapshot := g.CurrentSnapshot()
+	if snapshot.Width != 10 || snapshot.Height != 6 || len(snapshot.Players) != 0 {
+		t.Fatalf("unexpected board after reset: %dx%d with %d players", snapshot.Width, snapshot.Height, len(snapshot.Players))
+	}
+	if snapshot.Tick != 5 {
+		t.Fatalf("expected the tick counter to keep counting, got %d", snapshot.Tick)
+	}
+
+	bases := 0
+	for _, tile := range snapshot.Tiles {
+		if tile.ResourceBase {
+			bases++
+		}
+	}
+	if bases != 3 {
+		t.Fatalf("expected 3 resource bases, got %d", bases)
+	}
+	if _, _, ok := g.HistoryRange(); ok {
+		t.Fatalf("expected history to be cleared by reset")
+	}
+	if rules := g.Rules(); rules.SpreadRule != SpreadDistance || rules.SupplyGraceTicks != 4 {
+		t.Fatalf("expected the new match to start under the given rules, got %+v", rules)
+	}
+}
+
+func TestResetWithUnknownRulesLeavesTheMatchAlone(t *testing.T) {
+	g := NewGameWithSeed(8, 8, 4, 3)
+	if _, err := g.AddPlayer("player-1"); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+
+	if err := g.Reset(10, 6, 3, 9, Rules{SpreadRule: "loudest"}); !errors.Is(err, ErrUnknownSpreadRule) {
+		t.Fatalf("expected ErrUnknownSpreadRule, got %v", err)
+	}
+	snapshot := g.CurrentSnapshot()
+	if snapshot.Width != 8 || len(snapshot.Players) != 1 {
+		t.Fatalf("expected the old match to be kept, got %dx%d with %d players", snapshot.Width, snapshot.Height, len(snapshot.Players))
+	}
+}
@@ -0,0 +1,311 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultMinColorDistance is the smallest CIEDE2000 difference allowed
+// between two active players' colors unless changed with SetColorRules.
+const DefaultMinColorDistance = 10
+
+var ErrInvalidColor = errors.New("color must look like #rrggbb")
+
+// Palette is a named set of colors players can choose from.
+type Palette struct {
+	Name           string   `json:"name"`
+	Colors         []string `json:"colors"`
+	ColorblindSafe bool     `json:"colorblindSafe"`
+}
+
+// Palettes are the built-in palettes. The colorblind safe ones are the
+// Okabe-Ito set and Paul Tol's bright and vibrant schemes, without black
+// and white which would vanish against the board.
+var Palettes = []Palette{
+	{Name: "default", Colors: []string{
+		"#ff4f4f", "#4f83ff", "#4fff73", "#ff4fbd", "#ffb84f",
+		"#9b59ff", "#4ffff4", "#ffd24f", "#2ecc71", "#e74c3c",
+	}},
+	{Name: "okabe-ito", ColorblindSafe: true, Colors: []string{
+		"#e69f00", "#56b4e9", "#009e73", "#f0e442", "#0072b2", "#d55e00", "#cc79a7",
+	}},
+	{Name: "tol-bright", ColorblindSafe: true, Colors: []string{
+		"#4477aa", "#ee6677", "#228833", "#ccbb44", "#66ccee", "#aa3377", "#bbbbbb",
+	}},
+	{Name: "tol-vibrant", ColorblindSafe: true, Colors: []string{
+		"#ee7733", "#0077bb", "#33bbee", "#ee3377", "#cc3311", "#009988", "#bbbbbb",
+	}},
+}
+
+// FindPalette returns the built-in palette with the given name.
+func FindPalette(name string) (Palette, bool) {
+	for _, p := range Palettes {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return Palette{}, false
+}
+
+// SetColorRules sets the colors new players are assigned from and the
+// minimum distance between active players' colors. Players whose colors now
+// conflict are recolored: whoever joined first keeps their color.
+func (g *Game) SetColorRules(pool []string, minDistance float64) error {
+	normalized := make([]string, 0, len(pool))
+	for _, color := range pool {
+		if _, err := parseColor(color); err != nil {
+			return fmt.Errorf("%q: %w", color, err)
+		}
+		normalized = append(normalized, strings.ToLower(color))
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(normalized) > 0 {
+		g.colorPool = normalized
+	}
+	g.minColorDistance = minDistance
+	g.recordLocked(ReplayEvent{Kind: EventColorRules, Colors: normalized, MinColorDistance: minDistance})
+	g.resolveColorConflictsLocked()
+	return nil
+}
+
+// MinColorDistance returns the current minimum distance between colors.
+func (g *Game) MinColorDistance() float64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.minColorDistance
+}
+
+// resolveColorConflictsLocked walks the players in join order and recolors
+// any player too close to someone who joined before them. The recolorings
+// follow from the recorded rules, so they are not recorded themselves.
+func (g *Game) resolveColorConflictsLocked() {
+	players := make([]*Player, 0, len(g.players))
+	for _, p := range g.players {
+		players = append(players, p)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		if players[i].JoinedAtTick != players[j].JoinedAtTick {
+			return players[i].JoinedAtTick < players[j].JoinedAtTick
+		}
+		return players[i].ID < players[j].ID
+	})
+
+	var kept []string
+	for _, p := range players {
+		if !g.tooClose(p.Color, kept) {
+			kept = append(kept, p.Color)
+			continue
+		}
+		color := g.pickColor(kept)
+		p.Color = color
+		kept = append(kept, color)
+	}
+}
+
+// colorConflictLocked reports whether color is too close to the color of a
+// player other than playerID.
+func (g *Game) colorConflictLocked(playerID, color string) bool {
+	others := make([]string, 0, len(g.players))
+	for _, p := range g.players {
+		if p.ID != playerID {
+			others = append(others, p.Color)
+		}
+	}
+	return g.tooClose(color, others)
+}
+
+func (g *Game) tooClose(color string, others []string) bool {
+	for _, other := range others {
+		if strings.EqualFold(color, other) {
+			return true
+		}
+		if d, err := ColorDistance(color, other); err == nil && d < g.minColorDistance {
+			return true
+		}
+	}
+	return false
+}
+
+// pickColor picks a random pool color that keeps the minimum distance to
+// used. If there is none, it picks the generated color farthest from all of
+// them, so that a crowded game still gets the most distinct color left.
+func (g *Game) pickColor(used []string) string {
+	available := make([]string, 0, len(g.colorPool))
+	for _, c := range g.colorPool {
+		if !g.tooClose(c, used) {
+			available = append(available, c)
+		}
+	}
+	if len(available) > 0 {
+		rng := g.rand.get(streamColor)
+		return available[rng.Intn(len(available))]
+	}
+
+	best, bestDistance := "", -1.0
+	for _, c := range fallbackColors {
+		d := math.Inf(1)
+		for _, other := range used {
+			if od, err := ColorDistance(c, other); err == nil && od < d {
+				d = od
+			}
+		}
+		if d > bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best
+}
+
+// fallbackColors spread around the hue circle at two lightness levels.
+var fallbackColors = func() []string {
+	var colors []string
+	for _, lightness := range []float64{0.55, 0.4} {
+		for hue := 0; hue < 360; hue += 15 {
+			colors = append(colors, hslHex(float64(hue), 0.75, lightness))
+		}
+	}
+	return colors
+}()
+
+func hslHex(h, s, l float64) string {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	to := func(v float64) int { return int(math.Round((v + m) * 255)) }
+	return fmt.Sprintf("#%02x%02x%02x", to(r), to(g), to(b))
+}
+
+type lab struct{ l, a, b float64 }
+
+// ColorDistance is the CIEDE2000 difference between two #rrggbb colors.
+// Around 2 is barely noticeable; above 10 colors are clearly distinct.
+func ColorDistance(a, b string) (float64, error) {
+	la, err := parseColor(a)
+	if err != nil {
+		return 0, err
+	}
+	lb, err := parseColor(b)
+	if err != nil {
+		return 0, err
+	}
+	return ciede2000(la, lb), nil
+}
+
+func parseColor(color string) (lab, error) {
+	if len(color) != 7 || color[0] != '#' {
+		return lab{}, ErrInvalidColor
+	}
+	v, err := strconv.ParseUint(color[1:], 16, 32)
+	if err != nil {
+		return lab{}, ErrInvalidColor
+	}
+	return srgbToLab(float64(v>>16&0xff)/255, float64(v>>8&0xff)/255, float64(v&0xff)/255), nil
+}
+
+// srgbToLab converts to CIELAB under the D65 white point.
+func srgbToLab(r, g, b float64) lab {
+	linear := func(c float64) float64 {
+		if c <= 0.04045 {
+			return c / 12.92
+		}
+		return math.Pow((c+0.055)/1.055, 2.4)
+	}
+	r, g, b = linear(r), linear(g), linear(b)
+
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / 0.95047
+	y := 0.2126729*r + 0.7151522*g + 0.0721750*b
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return lab{l: 116*fy - 16, a: 500 * (fx - fy), b: 200 * (fy - fz)}
+}
+
+// ciede2000 follows Sharma, Wu and Dalal, "The CIEDE2000 color-difference
+// formula", with kL = kC = kH = 1.
+func ciede2000(c1, c2 lab) float64 {
+	deg := math.Pi / 180
+	pow7 := func(v float64) float64 { return math.Pow(v, 7) }
+
+	cBar := (math.Hypot(c1.a, c1.b) + math.Hypot(c2.a, c2.b)) / 2
+	g := 0.5 * (1 - math.Sqrt(pow7(cBar)/(pow7(cBar)+pow7(25))))
+	a1, a2 := (1+g)*c1.a, (1+g)*c2.a
+	cp1, cp2 := math.Hypot(a1, c1.b), math.Hypot(a2, c2.b)
+
+	hue := func(b, a float64) float64 {
+		if a == 0 && b == 0 {
+			return 0
+		}
+		h := math.Atan2(b, a) / deg
+		if h < 0 {
+			h += 360
+		}
+		return h
+	}
+	hp1, hp2 := hue(c1.b, a1), hue(c2.b, a2)
+
+	dL := c2.l - c1.l
+	dC := cp2 - cp1
+	dh := 0.0
+	if cp1*cp2 != 0 {
+		dh = hp2 - hp1
+		if dh > 180 {
+			dh -= 360
+		} else if dh < -180 {
+			dh += 360
+		}
+	}
+	dH := 2 * math.Sqrt(cp1*cp2) * math.Sin(dh/2*deg)
+
+	lBar := (c1.l + c2.l) / 2
+	cpBar := (cp1 + cp2) / 2
+	hBar := hp1 + hp2
+	if cp1*cp2 != 0 {
+		switch {
+		case math.Abs(hp1-hp2) <= 180:
+			hBar /= 2
+		case hp1+hp2 < 360:
+			hBar = (hBar + 360) / 2
+		default:
+			hBar = (hBar - 360) / 2
+		}
+	}
+
+	t := 1 - 0.17*math.Cos((hBar-30)*deg) + 0.24*math.Cos(2*hBar*deg) +
+		0.32*math.Cos((3*hBar+6)*deg) - 0.20*math.Cos((4*hBar-63)*deg)
+	dTheta := 30 * math.Exp(-math.Pow((hBar-275)/25, 2))
+	rc := 2 * math.Sqrt(pow7(cpBar)/(pow7(cpBar)+pow7(25)))
+	sl := 1 + 0.015*math.Pow(lBar-50, 2)/math.Sqrt(20+math.Pow(lBar-50, 2))
+	sc := 1 + 0.045*cpBar
+	sh := 1 + 0.015*cpBar*t
+	rt := -math.Sin(2*dTheta*deg) * rc
+
+	return math.Sqrt(math.Pow(dL/sl, 2) + math.Pow(dC/sc, 2) + math.Pow(dH/sh, 2) + rt*(dC/sc)*(dH/sh))
+}
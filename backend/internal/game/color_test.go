@@ -0,0 +1,89 @@
+package game
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestCIEDE2000(t *testing.T) {
+	// Pairs from the test data of Sharma, Wu and Dalal.
+	cases := []struct {
+		a, b lab
+		want float64
+	}{
+		{lab{50, 2.6772, -79.7751}, lab{50, 0, -82.7485}, 2.0425},
+		{lab{50, 2.5, 0}, lab{73, 25, -18}, 27.1492},
+		{lab{50, 2.5, 0}, lab{50, 0, -2.5}, 4.3065},
+		{lab{60.2574, -34.0099, 36.2677}, lab{60.4626, -34.1751, 39.4387}, 1.2644},
+		{lab{2.0776, 0.0795, -1.135}, lab{0.9033, -0.0636, -0.5514}, 0.9082},
+	}
+	for _, c := range cases {
+		if got := ciede2000(c.a, c.b); math.Abs(got-c.want) > 1e-4 {
+			t.Errorf("ciede2000(%v, %v) = %.4f, want %.4f", c.a, c.b, got, c.want)
+		}
+		if got := ciede2000(c.b, c.a); math.Abs(got-c.want) > 1e-4 {
+			t.Errorf("ciede2000 is not symmetric for %v, %v", c.a, c.b)
+		}
+	}
+}
+
+func TestPickColorKeepsDistance(t *testing.T) {
+	g := NewGameWithSeed(20, 20, 0, 3)
+	for i := 0; i < 16; i++ {
+		g.AddPlayer(string(rune('a' + i)))
+	}
+
+	snapshot := g.CurrentSnapshot()
+	var colors []string
+	for _, p := range snapshot.Players {
+		colors = append(colors, p.Color)
+	}
+	for i := range colors {
+		for j := i + 1; j < len(colors); j++ {
+			if d, err := ColorDistance(colors[i], colors[j]); err != nil || d < DefaultMinColorDistance/2 {
+				t.Fatalf("%s and %s are too close: %.1f %v", colors[i], colors[j], d, err)
+			}
+		}
+	}
+}
+
+func TestSetColorRulesResolvesConflictsByJoinOrder(t *testing.T) {
+	g := NewGameWithSeed(12, 12, 0, 9)
+	if _, err := g.AddPlayerAt("b", Position{X: 1, Y: 1}, "#e69f00"); err != nil {
+		t.Fatal(err)
+	}
+	g.Tick()
+	if _, err := g.AddPlayerAt("a", Position{X: 8, Y: 8}, "#ee7733"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.StartRecording("colors"); err != nil {
+		t.Fatal(err)
+	}
+
+	okabeIto, _ := FindPalette("okabe-ito")
+	if err := g.SetColorRules(okabeIto.Colors, 20); err != nil {
+		t.Fatal(err)
+	}
+	g.Tick()
+
+	snapshot := g.CurrentSnapshot()
+	if got := snapshot.Players["b"].Color; got != "#e69f00" {
+		t.Fatalf("the earlier player must keep their color, got %s", got)
+	}
+	recolored := snapshot.Players["a"].Color
+	if d, _ := ColorDistance(recolored, "#e69f00"); d < 20 {
+		t.Fatalf("the later player got %s, only %.1f away", recolored, d)
+	}
+	if err := g.SetProfile("a", "", "#f0a010"); !errors.Is(err, ErrColorTaken) {
+		t.Fatalf("expected ErrColorTaken for a close color, got %v", err)
+	}
+
+	log, err := g.Recording()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyReplay(log); err != nil {
+		t.Fatal(err)
+	}
+}
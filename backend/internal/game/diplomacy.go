@@ -0,0 +1,203 @@
+package game
+
+import (
+	"errors"
+	"strconv"
+)
+
+type AgreementKind string
+
+const (
+	// AgreementTruce stops the two players' spreads from taking each other's
+	// tiles.
+	AgreementTruce AgreementKind = "truce"
+	// AgreementNonAggression keeps each player out of the tiles around the
+	// other's cores.
+	AgreementNonAggression AgreementKind = "nonAggression"
+)
+
+// NonAggressionRadius is how far around a core a non-aggression pact
+// protects the tiles of its owner.
+const NonAggressionRadius = 2
+
+var (
+	ErrUnknownAgreementKind = errors.New("unknown agreement kind")
+	ErrInvalidAgreement     = errors.New("an agreement needs two different players and a positive duration")
+	ErrAgreementExists      = errors.New("an agreement of that kind is already in force")
+	ErrUnknownAgreement     = errors.New("unknown agreement")
+	ErrNotAParty            = errors.New("player is not a party to the agreement")
+)
+
+// Agreement is a diplomatic agreement between two players. It is in force
+// from the tick after StartTick up to and including EndTick.
+type Agreement struct {
+	ID        string        `json:"id"`
+	Kind      AgreementKind `json:"kind"`
+	Players   [2]string     `json:"players"`
+	StartTick int64         `json:"startTick"`
+	EndTick   int64         `json:"endTick"`
+	// Penalty is how many resources the player who breaks the agreement
+	// hands to the other one.
+	Penalty int `json:"penalty"`
+	// BrokenBy is only set on the agreement returned by BreakAgreement.
+	BrokenBy string `json:"brokenBy,omitempty"`
+}
+
+func (a Agreement) involves(playerID string) bool {
+	return a.Players[0] == playerID || a.Players[1] == playerID
+}
+
+func (a Agreement) between(x, y string) bool {
+	return a.involves(x) && a.involves(y) && x != y
+}
+
+// MakeAgreement puts an agreement between two players in force for the next
+// ticks ticks. A pair of players can only have one agreement of each kind.
+func (g *Game) MakeAgreement(kind AgreementKind, a, b string, ticks int64, penalty int) (Agreement, error) {
+	switch kind {
+	case AgreementTruce, AgreementNonAggression:
+	default:
+		return Agreement{}, ErrUnknownAgreementKind
+	}
+	if a == b || ticks <= 0 || penalty < 0 {
+		return Agreement{}, ErrInvalidAgreement
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.players[a] == nil || g.players[b] == nil {
+		return Agreement{}, ErrUnknownPlayer
+	}
+	for _, existing := range g.agreements {
+		if existing.Kind == kind && existing.between(a, b) {
+			return Agreement{}, ErrAgreementExists
+		}
+	}
+	if b < a {
+		a, b = b, a
+	}
+
+	g.nextAgreementID++
+	agreement := Agreement{
+		ID:        "a" + strconv.Itoa(g.nextAgreementID),
+		Kind:      kind,
+		Players:   [2]string{a, b},
+		StartTick: g.tick,
+		EndTick:   g.tick + ticks,
+		Penalty:   penalty,
+	}
+	g.recordLocked(ReplayEvent{Kind: EventAgreement, Agreement: &agreement})
+	g.agreements = append(g.agreements, agreement)
+	return agreement, nil
+}
+
+// BreakAgreement ends an agreement early. The player breaking it pays the
+// penalty to the other party, as far as their resources go.
+func (g *Game) BreakAgreement(id, playerID string) (Agreement, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i, agreement := range g.agreements {
+		if agreement.ID != id {
+			continue
+		}
+		if !agreement.involves(playerID) {
+			return Agreement{}, ErrNotAParty
+		}
+
+		g.recordLocked(ReplayEvent{Kind: EventBreakAgreement, PlayerID: playerID, AgreementID: id})
+		g.agreements = append(g.agreements[:i:i], g.agreements[i+1:]...)
+
+		other := agreement.Players[0]
+		if other == playerID {
+			other = agreement.Players[1]
+		}
+		if breaker, victim := g.players[playerID], g.players[other]; breaker != nil && victim != nil {
+			paid := min(agreement.Penalty, breaker.ResourceCount)
+			breaker.ResourceCount -= paid
+			victim.ResourceCount += paid
+		}
+		agreement.BrokenBy = playerID
+		return agreement, nil
+	}
+	return Agreement{}, ErrUnknownAgreement
+}
+
+// Agreements returns the agreements in force in the order they were made.
+func (g *Game) Agreements() []Agreement {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return cloneAgreements(g.agreements)
+}
+
+// protectedLocked reports whether an agreement keeps attacker from taking
+// owner's tile at pos.
+func (g *Game) protectedLocked(pos Position, owner, attacker string) bool {
+	for _, agreement := range g.agreements {
+		if !agreement.between(owner, attacker) {
+			continue
+		}
+		switch agreement.Kind {
+		case AgreementTruce:
+			return true
+		case AgreementNonAggression:
+			if g.nearCoreLocked(pos, owner, NonAggressionRadius) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (g *Game) nearCoreLocked(pos Position, playerID string, radius int) bool {
+	return g.coreDistanceLocked(pos, playerID) <= radius
+}
+
+// coreDistanceLocked returns how many steps pos is from playerID's nearest
+// core, or the board size when the player has none.
+func (g *Game) coreDistanceLocked(pos Position, playerID string) int {
+	best := g.width + g.height
+	if player := g.players[playerID]; player != nil {
+		for _, core := range player.CorePositions {
+			best = min(best, max(abs(core.X-pos.X), abs(core.Y-pos.Y)))
+		}
+	}
+	return best
+}
+
+// expireAgreementsLocked drops the agreements whose last tick has run.
+func (g *Game) expireAgreementsLocked() {
+	active := g.agreements[:0]
+	for _, agreement := range g.agreements {
+		if agreement.EndTick > g.tick {
+			active = append(active, agreement)
+		}
+	}
+	g.agreements = active
+}
+
+// dropAgreementsLocked removes every agreement playerID is a party to.
+func (g *Game) dropAgreementsLocked(playerID string) {
+	active := g.agreements[:0]
+	for _, agreement := range g.agreements {
+		if !agreement.involves(playerID) {
+			active = append(active, agreement)
+		}
+	}
+	g.agreements = active
+}
+
+func cloneAgreements(agreements []Agreement) []Agreement {
+	if len(agreements) == 0 {
+		return nil
+	}
+	return append([]Agreement(nil), agreements...)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,109 @@
+package game
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAgreementsProtectTiles(t *testing.T) {
+	near, far := Position{X: 2, Y: 1}, Position{X: 4, Y: 1}
+	cases := []struct {
+		kind              AgreementKind
+		wantNear, wantFar string
+	}{
+		{"", "b", "b"},
+		{AgreementNonAggression, "a", "b"},
+		{AgreementTruce, "a", "a"},
+	}
+
+	for _, c := range cases {
+		g := NewGameWithSeed(8, 3, 0, 1)
+		g.AddPlayerAt("a", Position{X: 0, Y: 1}, "#ff0000")
+		g.AddPlayerAt("b", Position{X: 3, Y: 1}, "#0000ff")
+		g.tiles[posKey(near)].OwnerID = "a"
+		g.tiles[posKey(far)].OwnerID = "a"
+		if c.kind != "" {
+			if _, err := g.MakeAgreement(c.kind, "a", "b", 5, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		g.Tick()
+
+		if got := g.tiles[posKey(near)].OwnerID; got != c.wantNear {
+			t.Errorf("%q: tile near a's core owned by %q, want %q", c.kind, got, c.wantNear)
+		}
+		if got := g.tiles[posKey(far)].OwnerID; got != c.wantFar {
+			t.Errorf("%q: tile far from a's core owned by %q, want %q", c.kind, got, c.wantFar)
+		}
+	}
+}
+
+func TestAgreementsExpireAndBreak(t *testing.T) {
+	g := NewGameWithSeed(10, 10, 0, 2)
+	if err := g.StartRecording("diplomacy"); err != nil {
+		t.Fatal(err)
+	}
+	g.AddPlayerAt("a", Position{X: 1, Y: 1}, "")
+	g.AddPlayerAt("b", Position{X: 8, Y: 8}, "")
+
+	truce, err := g.MakeAgreement(AgreementTruce, "b", "a", 2, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.MakeAgreement(AgreementTruce, "a", "b", 2, 5); !errors.Is(err, ErrAgreementExists) {
+		t.Fatalf("expected ErrAgreementExists, got %v", err)
+	}
+	if truce.Players != [2]string{"a", "b"} || truce.EndTick != truce.StartTick+2 {
+		t.Fatalf("unexpected agreement %+v", truce)
+	}
+
+	if snapshot := g.Tick(); len(snapshot.Agreements) != 1 {
+		t.Fatalf("expected the truce to be in force, got %+v", snapshot.Agreements)
+	}
+	if snapshot := g.Tick(); len(snapshot.Agreements) != 0 {
+		t.Fatalf("expected the truce to expire, got %+v", snapshot.Agreements)
+	}
+
+	pact, err := g.MakeAgreement(AgreementNonAggression, "a", "b", 50, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.BreakAgreement(pact.ID, "c"); !errors.Is(err, ErrNotAParty) {
+		t.Fatalf("expected ErrNotAParty, got %v", err)
+	}
+	if _, err := g.BreakAgreement(pact.ID, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot := g.Tick(); len(snapshot.Agreements) != 0 {
+		t.Fatalf("expected the broken pact to be gone, got %+v", snapshot.Agreements)
+	}
+
+	log, err := g.Recording()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyReplay(log); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBreakingAnAgreementPaysThePenalty(t *testing.T) {
+	g := NewGameWithSeed(10, 10, 0, 3)
+	g.AddPlayerAt("a", Position{X: 1, Y: 1}, "")
+	g.AddPlayerAt("b", Position{X: 8, Y: 8}, "")
+	g.players["a"].ResourceCount = 3
+
+	pact, err := g.MakeAgreement(AgreementNonAggression, "a", "b", 50, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.BreakAgreement(pact.ID, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if a, b := g.players["a"].ResourceCount, g.players["b"].ResourceCount; a != 0 || b != 3 {
+		t.Fatalf("expected the penalty to move 3 resources from a to b, got a=%d b=%d", a, b)
+	}
+	if _, err := g.BreakAgreement(pact.ID, "a"); !errors.Is(err, ErrUnknownAgreement) {
+		t.Fatalf("expected ErrUnknownAgreement, got %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
 )
@@ -22,10 +23,18 @@ type Tile struct {
 	HasResource  bool     `json:"hasResource"`
 	CoreBorder   bool     `json:"coreBorder"`
 	ResourceBase bool     `json:"resourceBase"`
+	// Influence is each player's influence on the tile. It is only kept
+	// when the match uses influence rules.
+	Influence map[string]float64 `json:"influence,omitempty"`
+	// DisconnectedSince is the tick the tile was cut off from its side's
+	// cores. It is only set under the supply rule.
+	DisconnectedSince int64 `json:"disconnectedSince,omitempty"`
 }
 
 type Player struct {
 	ID            string     `json:"id"`
+	DisplayName   string     `json:"displayName,omitempty"`
+	Team          string     `json:"team,omitempty"`
 	Color         string     `json:"color"`
 	CorePositions []Position `json:"corePositions"`
 	ResourceCount int        `json:"resourceCount"`
@@ -45,6 +54,10 @@ type GameSnapshot struct {
 	Players   map[string]Player `json:"players"`
 	Tiles     []Tile            `json:"tiles"`
 	Resources []Resource        `json:"resources"`
+	// Teams is keyed by team name and only lists teams with members.
+	Teams      map[string]TeamScore `json:"teams,omitempty"`
+	Winner     *Winner              `json:"winner,omitempty"`
+	Agreements []Agreement          `json:"agreements,omitempty"`
 }
 
 type Game struct {
@@ -58,15 +71,30 @@ type Game struct {
 	resourceByPos  map[string]string
 	pendingSpreads map[string]spreadBucket
 	tick           int64
-	rng            *rand.Rand
+	seed           int64
+	rand           randomStreams
 	subscribers    map[int]chan GameSnapshot
 	nextSubscriber int
 	colorPool      []string
-	nextResourceID int
+	// minColorDistance is the smallest CIEDE2000 difference allowed between
+	// two players' colors.
+	minColorDistance float64
+	nextResourceID   int
+	rules            Rules
+	resolver         SpreadResolver
+	winner           *Winner
+	agreements       []Agreement
+	nextAgreementID  int
+	recording        *ReplayLog
+	history          *History
 }
 
 type spreadBucket map[string]map[string]Position
 
+// DefaultHistoryTicks is how many past ticks a game keeps queryable unless
+// changed with SetHistoryLimit.
+const DefaultHistoryTicks = 120
+
 const (
 	TileNormal   TileType = "normal"
 	TileCore     TileType = "core"
@@ -78,10 +106,49 @@ var (
 )
 
 func NewGame(width, height, resourceBases int) *Game {
-	return NewGameWithRand(width, height, resourceBases, rand.New(rand.NewSource(time.Now().UnixNano())))
+	return NewGameWithSeed(width, height, resourceBases, time.Now().UnixNano())
+}
+
+// NewGameWithSeed creates a fully deterministic game: two games created with
+// the same arguments and fed the same inputs produce identical states on
+// every tick. The random number generator positions are part of the saved
+// state, so a loaded game continues the same sequences.
+func NewGameWithSeed(width, height, resourceBases int, seed int64) *Game {
+	g := newGame(width, height, seededStreams(seed))
+	g.seed = seed
+	g.seedResourceTiles(resourceBases)
+	return g
 }
 
+// NewGameWithRand creates a game seeded from rng. The position of an
+// arbitrary rng cannot be saved, so the game draws its seed once and is
+// otherwise a seeded game that can be saved and replayed.
 func NewGameWithRand(width, height, resourceBases int, rng *rand.Rand) *Game {
+	return NewGameWithSeed(width, height, resourceBases, rng.Int63())
+}
+
+func newGame(width, height int, streams randomStreams) *Game {
+	g := &Game{
+		width:            width,
+		height:           height,
+		players:          make(map[string]*Player),
+		tiles:            newTiles(width, height),
+		resourceTiles:    make(map[string]bool),
+		resources:        make(map[string]*Resource),
+		resourceByPos:    make(map[string]string),
+		pendingSpreads:   make(map[string]spreadBucket),
+		rand:             streams,
+		history:          NewHistory(DefaultHistoryTicks),
+		subscribers:      make(map[int]chan GameSnapshot),
+		colorPool:        append([]string(nil), Palettes[0].Colors...),
+		minColorDistance: DefaultMinColorDistance,
+		resolver:         MajorityResolver{},
+	}
+
+	return g
+}
+
+func newTiles(width, height int) map[string]*Tile {
 	tiles := make(map[string]*Tile, width*height)
 	for x := 0; x < width; x++ {
 		for y := 0; y < height; y++ {
@@ -92,27 +159,7 @@ func NewGameWithRand(width, height, resourceBases int, rng *rand.Rand) *Game {
 			}
 		}
 	}
-
-	g := &Game{
-		width:          width,
-		height:         height,
-		players:        make(map[string]*Player),
-		tiles:          tiles,
-		resourceTiles:  make(map[string]bool),
-		resources:      make(map[string]*Resource),
-		resourceByPos:  make(map[string]string),
-		pendingSpreads: make(map[string]spreadBucket),
-		rng:            rng,
-		subscribers:    make(map[int]chan GameSnapshot),
-		colorPool: []string{
-			"#ff4f4f", "#4f83ff", "#4fff73", "#ff4fbd", "#ffb84f",
-			"#9b59ff", "#4ffff4", "#ffd24f", "#2ecc71", "#e74c3c",
-		},
-	}
-
-	g.seedResourceTiles(resourceBases)
-
-	return g
+	return tiles
 }
 
 func posKey(pos Position) string {
@@ -123,13 +170,11 @@ func (g *Game) seedResourceTiles(count int) {
 	if count <= 0 {
 		return
 	}
-	available := make([]Position, 0, len(g.tiles))
-	for _, tile := range g.tiles {
-		available = append(available, tile.Position)
-	}
+	rng := g.rand.get(streamMap)
+	available := g.positionsLocked()
 
 	for i := 0; i < count && len(available) > 0; i++ {
-		idx := g.rng.Intn(len(available))
+		idx := rng.Intn(len(available))
 		choice := available[idx]
 		key := posKey(choice)
 		tile := g.tiles[key]
@@ -159,11 +204,13 @@ func (g *Game) AddPlayer(id string) (*Player, error) {
 
 	player := &Player{
 		ID:            id,
+		Team:          g.rules.Teams[id],
 		Color:         color,
 		CorePositions: []Position{pos},
 		JoinedAtTick:  g.tick,
 	}
 	g.players[id] = player
+	g.recordLocked(ReplayEvent{Kind: EventJoin, PlayerID: id})
 
 	tile := g.tiles[posKey(pos)]
 	tile.Type = TileCore
@@ -191,12 +238,15 @@ func (g *Game) AddPlayerAt(id string, pos Position, color string) (*Player, erro
 		return nil, fmt.Errorf("tile %s already contains a core", tkey)
 	}
 
+	g.recordLocked(ReplayEvent{Kind: EventJoin, PlayerID: id, Position: &pos, Color: color})
+
 	if color == "" {
 		color = g.nextColor()
 	}
 
 	player := &Player{
 		ID:            id,
+		Team:          g.rules.Teams[id],
 		Color:         color,
 		CorePositions: []Position{pos},
 		JoinedAtTick:  g.tick,
@@ -210,41 +260,133 @@ func (g *Game) AddPlayerAt(id string, pos Position, color string) (*Player, erro
 	return clonePlayer(player), nil
 }
 
-func (g *Game) nextColor() string {
-	used := make(map[string]bool)
-	for _, p := range g.players {
-		used[p.Color] = true
+func (g *Game) RemovePlayer(id string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	player, ok := g.players[id]
+	if !ok {
+		return false
 	}
+	g.recordLocked(ReplayEvent{Kind: EventLeave, PlayerID: id})
 
-	available := make([]string, 0, len(g.colorPool))
-	for _, c := range g.colorPool {
-		if !used[c] {
-			available = append(available, c)
+	for _, core := range player.CorePositions {
+		key := posKey(core)
+		tile := g.tiles[key]
+		if tile == nil {
+			continue
+		}
+		tile.Type = TileNormal
+		if g.resourceTiles[key] {
+			tile.Type = TileResource
 		}
+		tile.CoreBorder = false
 	}
 
-	if len(available) == 0 {
-		return fmt.Sprintf("#%06x", g.rng.Intn(0xffffff))
+	for _, tile := range g.tiles {
+		if tile.OwnerID == id {
+			tile.OwnerID = ""
+			tile.DisconnectedSince = 0
+		}
+		delete(tile.Influence, id)
 	}
 
-	return available[g.rng.Intn(len(available))]
+	for _, res := range g.resources {
+		if res.OwnerID == id {
+			res.OwnerID = ""
+		}
+	}
+
+	for _, bucket := range g.pendingSpreads {
+		delete(bucket, id)
+	}
+
+	g.dropAgreementsLocked(id)
+	delete(g.players, id)
+	return true
+}
+
+// SetProfile changes a player's display name and color. An empty color keeps
+// the current one; a color too close to another player's is rejected.
+func (g *Game) SetProfile(playerID, displayName, color string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	player, ok := g.players[playerID]
+	if !ok {
+		return ErrUnknownPlayer
+	}
+	if color == "" {
+		color = player.Color
+	}
+	if color != player.Color && g.colorConflictLocked(playerID, color) {
+		return ErrColorTaken
+	}
+	if displayName == player.DisplayName && color == player.Color {
+		return nil
+	}
+
+	g.recordLocked(ReplayEvent{Kind: EventProfile, PlayerID: playerID, DisplayName: displayName, Color: color})
+	player.DisplayName = displayName
+	player.Color = color
+	return nil
+}
+
+// ColorAvailable reports whether playerID could switch to color.
+func (g *Game) ColorAvailable(playerID, color string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return !g.colorConflictLocked(playerID, color)
+}
+
+func (g *Game) nextColor() string {
+	used := make([]string, 0, len(g.players))
+	for _, p := range g.players {
+		used = append(used, p.Color)
+	}
+	return g.pickColor(used)
 }
 
 func (g *Game) randomAvailableCorePositionLocked() (Position, error) {
 	candidates := make([]Position, 0)
-	for _, tile := range g.tiles {
+	for _, pos := range g.positionsLocked() {
+		tile := g.tiles[posKey(pos)]
 		if tile.Type == TileCore || tile.CoreBorder || tile.Type == TileResource {
 			continue
 		}
-		candidates = append(candidates, tile.Position)
+		candidates = append(candidates, pos)
 	}
 	if len(candidates) == 0 {
 		return Position{}, errNoAvailableCore
 	}
-	pos := candidates[g.rng.Intn(len(candidates))]
+	pos := candidates[g.rand.get(streamSpawn).Intn(len(candidates))]
 	return pos, nil
 }
 
+// positionsLocked lists every position on the board in a fixed order. Map
+// iteration order is random, so anything that feeds the rng or depends on
+// processing order must walk the board through this instead.
+func (g *Game) positionsLocked() []Position {
+	positions := make([]Position, 0, g.width*g.height)
+	for x := 0; x < g.width; x++ {
+		for y := 0; y < g.height; y++ {
+			positions = append(positions, Position{X: x, Y: y})
+		}
+	}
+	return positions
+}
+
+// sortedPlayerIDsLocked returns the player ids in a fixed order.
+func (g *Game) sortedPlayerIDsLocked() []string {
+	ids := make([]string, 0, len(g.players))
+	for id := range g.players {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
 func (g *Game) isInBounds(pos Position) bool {
 	return pos.X >= 0 && pos.Y >= 0 && pos.X < g.width && pos.Y < g.height
 }
@@ -274,14 +416,25 @@ func (g *Game) Tick() GameSnapshot {
 		incoming[key] = cloneSpreadBucket(bucket)
 	}
 
+	if g.rules.Influence != nil {
+		g.decayInfluenceLocked()
+	}
 	g.applyCoreSpreadsLocked(incoming)
 	nextSpreads := g.resolveSpreadsLocked(incoming)
 	g.pendingSpreads = nextSpreads
+	g.updateSupplyLocked()
 
 	distanceMaps := g.buildDistanceMapsLocked()
 	g.handleResourcesLocked(distanceMaps)
+	g.checkWinLocked()
+	g.expireAgreementsLocked()
+
+	if g.recording != nil {
+		g.recording.Hashes = append(g.recording.Hashes, g.hashLocked())
+	}
 
 	snapshot := g.snapshotLocked()
+	g.history.Record(snapshot)
 	subscribers := g.cloneSubscribersLocked()
 	g.mu.Unlock()
 
@@ -296,7 +449,8 @@ func (g *Game) Tick() GameSnapshot {
 }
 
 func (g *Game) applyCoreSpreadsLocked(incoming map[string]spreadBucket) {
-	for _, player := range g.players {
+	for _, id := range g.sortedPlayerIDsLocked() {
+		player := g.players[id]
 		for _, core := range player.CorePositions {
 			for _, nb := range g.neighbors(core) {
 				g.addSpread(incoming, posKey(nb), player.ID, core)
@@ -308,37 +462,37 @@ func (g *Game) applyCoreSpreadsLocked(incoming map[string]spreadBucket) {
 func (g *Game) resolveSpreadsLocked(incoming map[string]spreadBucket) map[string]spreadBucket {
 	nextSpreads := make(map[string]spreadBucket)
 
-	for key, bucket := range incoming {
+	for _, key := range sortedKeys(incoming) {
+		bucket := incoming[key]
 		tile := g.tiles[key]
 		if tile == nil {
 			continue
 		}
 
-		var topPlayer string
-		var topCount int
-		var contested bool
-
-		for playerID, origins := range bucket {
-			count := len(origins)
-			if count == 0 {
-				continue
+		if tile.Type != TileCore {
+			contest := SpreadContest{
+				Position:  tile.Position,
+				Owner:     tile.OwnerID,
+				Spreads:   make(map[string]int, len(bucket)),
+				Influence: tile.Influence,
+				Side:      g.sideLocked,
+				CoreDistance: func(playerID string) int {
+					return g.coreDistanceLocked(tile.Position, playerID)
+				},
+				Rand: g.rand.get(streamSpread),
 			}
-			if count > topCount {
-				topCount = count
-				topPlayer = playerID
-				contested = false
-			} else if count == topCount && playerID != topPlayer {
-				contested = true
+			for playerID, origins := range bucket {
+				if len(origins) > 0 {
+					contest.Spreads[playerID] = len(origins)
+				}
 			}
-		}
-
-		ownerBefore := tile.OwnerID
-		if topCount > 0 && !contested {
-			tile.OwnerID = topPlayer
-		}
 
-		if tile.Type == TileCore {
-			tile.OwnerID = ownerBefore
+			leader := g.resolver.Resolve(&contest)
+			tile.Influence = contest.Influence
+			if leader != "" && (tile.OwnerID == "" || !g.protectedLocked(tile.Position, tile.OwnerID, leader)) {
+				tile.OwnerID = leader
+				tile.DisconnectedSince = 0
+			}
 		}
 
 		if tile.OwnerID == "" {
@@ -350,7 +504,8 @@ func (g *Game) resolveSpreadsLocked(incoming map[string]spreadBucket) map[string
 			continue
 		}
 
-		for _, origin := range ownerOrigins {
+		for _, originKey := range sortedKeys(ownerOrigins) {
+			origin := ownerOrigins[originKey]
 			for _, nb := range g.neighbors(tile.Position) {
 				if nb.X == origin.X && nb.Y == origin.Y {
 					continue
@@ -397,7 +552,11 @@ func (g *Game) addSpread(storage map[string]spreadBucket, key string, playerID s
 
 func (g *Game) handleResourcesLocked(distanceMaps map[string]map[string]int) {
 	// Spawn resources
-	for key := range g.resourceTiles {
+	for _, pos := range g.positionsLocked() {
+		key := posKey(pos)
+		if !g.resourceTiles[key] {
+			continue
+		}
 		if _, has := g.resourceByPos[key]; !has {
 			g.nextResourceID++
 			resID := fmt.Sprintf("res-%d", g.nextResourceID)
@@ -410,20 +569,25 @@ func (g *Game) handleResourcesLocked(distanceMaps map[string]map[string]int) {
 		}
 	}
 
-	// Move resources
-	for id, res := range g.resources {
+	// Move resources. Resources block each other, so the order they move in
+	// matters and must not depend on map iteration.
+	for _, id := range g.sortedResourceIDsLocked() {
+		res := g.resources[id]
 		key := posKey(res.Position)
 		tile := g.tiles[key]
 		if tile == nil {
 			continue
 		}
 
+		// Resources on tiles cut off from their cores stay where they are.
 		tileOwner := tile.OwnerID
-		if tileOwner == "" {
+		if tileOwner == "" || tile.DisconnectedSince != 0 {
 			continue
 		}
 
-		distances := distanceMaps[tileOwner]
+		// Resources head for the nearest core of the owner's side and are
+		// credited to whoever owns the core they reach.
+		distances := distanceMaps[g.sideLocked(tileOwner)]
 		if len(distances) == 0 {
 			continue
 		}
@@ -460,6 +624,30 @@ func (g *Game) handleResourcesLocked(distanceMaps map[string]map[string]int) {
 	g.refreshTileResourceFlagsLocked()
 }
 
+// sortedResourceIDsLocked returns resource ids in spawn order.
+func (g *Game) sortedResourceIDsLocked() []string {
+	ids := make([]string, 0, len(g.resources))
+	for id := range g.resources {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if len(ids[i]) != len(ids[j]) {
+			return len(ids[i]) < len(ids[j])
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func (g *Game) refreshTileResourceFlagsLocked() {
 	for key, tile := range g.tiles {
 		_, has := g.resourceByPos[key]
@@ -504,15 +692,23 @@ func (g *Game) nextStepTowards(current Position, distances map[string]int) (Posi
 	return best, true
 }
 
+// buildDistanceMapsLocked returns, per side, the distance of every tile to
+// the nearest core of that side.
 func (g *Game) buildDistanceMapsLocked() map[string]map[string]int {
-	result := make(map[string]map[string]int, len(g.players))
+	cores := make(map[string][]Position)
+	for _, id := range g.sortedPlayerIDsLocked() {
+		side := g.sideLocked(id)
+		cores[side] = append(cores[side], g.players[id].CorePositions...)
+	}
+
+	result := make(map[string]map[string]int, len(cores))
 	queue := make([]Position, 0)
 
-	for id, player := range g.players {
+	for side, sources := range cores {
 		distances := make(map[string]int, g.width*g.height)
 
 		queue = queue[:0]
-		for _, core := range player.CorePositions {
+		for _, core := range sources {
 			key := posKey(core)
 			distances[key] = 0
 			queue = append(queue, core)
@@ -533,7 +729,7 @@ func (g *Game) buildDistanceMapsLocked() map[string]map[string]int {
 			}
 		}
 
-		result[id] = distances
+		result[side] = distances
 	}
 
 	return result
@@ -541,8 +737,8 @@ func (g *Game) buildDistanceMapsLocked() map[string]map[string]int {
 
 func (g *Game) snapshotLocked() GameSnapshot {
 	tiles := make([]Tile, 0, len(g.tiles))
-	for _, tile := range g.tiles {
-		tiles = append(tiles, *tile)
+	for _, pos := range g.positionsLocked() {
+		tiles = append(tiles, cloneTile(g.tiles[posKey(pos)]))
 	}
 
 	players := make(map[string]Player, len(g.players))
@@ -551,17 +747,20 @@ func (g *Game) snapshotLocked() GameSnapshot {
 	}
 
 	resources := make([]Resource, 0, len(g.resources))
-	for _, res := range g.resources {
-		resources = append(resources, *res)
+	for _, id := range g.sortedResourceIDsLocked() {
+		resources = append(resources, *g.resources[id])
 	}
 
 	return GameSnapshot{
-		Tick:      g.tick,
-		Width:     g.width,
-		Height:    g.height,
-		Players:   players,
-		Tiles:     tiles,
-		Resources: resources,
+		Tick:       g.tick,
+		Width:      g.width,
+		Height:     g.height,
+		Players:    players,
+		Tiles:      tiles,
+		Resources:  resources,
+		Teams:      g.teamScoresLocked(),
+		Winner:     cloneWinner(g.winner),
+		Agreements: cloneAgreements(g.agreements),
 	}
 }
 
@@ -604,6 +803,40 @@ func (g *Game) CurrentSnapshot() GameSnapshot {
 	return g.snapshotLocked()
 }
 
+func (g *Game) CurrentTick() int64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.tick
+}
+
+// SetHistoryLimit changes how many past ticks stay queryable.
+func (g *Game) SetHistoryLimit(ticks int) {
+	g.history.SetLimit(ticks)
+}
+
+// HistoryRange returns the oldest and latest tick that can be queried.
+func (g *Game) HistoryRange() (oldest, latest int64, ok bool) {
+	return g.history.Range()
+}
+
+// SnapshotAt returns the snapshot taken at the end of the given tick.
+// ErrTickExpired is returned once the tick has left the history window.
+func (g *Game) SnapshotAt(tick int64) (GameSnapshot, error) {
+	return g.history.At(tick)
+}
+
+// DiffTicks returns the changes between the snapshots of two ticks.
+func (g *Game) DiffTicks(from, to int64) (SnapshotDelta, error) {
+	return g.history.Between(from, to)
+}
+
+// DeltasSince returns the per-tick deltas from the given tick up to the
+// latest one.
+func (g *Game) DeltasSince(tick int64) ([]SnapshotDelta, error) {
+	return g.history.Since(tick)
+}
+
 func (g *Game) Player(id string) (*Player, bool) {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
@@ -616,6 +849,13 @@ func (g *Game) Player(id string) (*Player, bool) {
 	return &copy, true
 }
 
+// InBounds reports whether pos is on the board.
+func (g *Game) InBounds(pos Position) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.isInBounds(pos)
+}
+
 func clonePlayer(p *Player) *Player {
 	copy := *p
 	copy.CorePositions = append([]Position(nil), p.CorePositions...)
@@ -1,6 +1,7 @@
 package game
 
 import (
+	"errors"
 	"math/rand"
 	"testing"
 )
@@ -55,3 +56,71 @@ func TestResourceMovementTowardsCore(t *testing.T) {
 		t.Fatalf("player disappeared from game state")
 	}
 }
+
+func TestRemovePlayerReleasesTerritory(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	g := NewGameWithRand(6, 6, 0, rng)
+
+	corePos := Position{X: 2, Y: 2}
+	if _, err := g.AddPlayerAt("player-1", corePos, "#123456"); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+	g.Tick()
+
+	if !g.RemovePlayer("player-1") {
+		t.Fatalf("expected player to be removed")
+	}
+
+	for key, tile := range g.tiles {
+		if tile.OwnerID != "" {
+			t.Fatalf("expected tile %s to be neutral, owned by %s", key, tile.OwnerID)
+		}
+	}
+	if tile := g.tiles[posKey(corePos)]; tile.Type != TileNormal || tile.CoreBorder {
+		t.Fatalf("expected core tile to be reset, got %+v", tile)
+	}
+	if g.RemovePlayer("player-1") {
+		t.Fatalf("expected second removal to report false")
+	}
+}
+
+func TestSetProfileIsRecordedAndKeepsColorsUnique(t *testing.T) {
+	g := NewGameWithSeed(12, 12, 6, 5)
+	if _, err := g.AddPlayerAt("a", Position{X: 1, Y: 1}, "#111111"); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+	if _, err := g.AddPlayerAt("b", Position{X: 8, Y: 8}, "#222222"); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+	if err := g.StartRecording("profiles"); err != nil {
+		t.Fatalf("failed to start recording: %v", err)
+	}
+
+	if err := g.SetProfile("a", "Alice", "#222222"); !errors.Is(err, ErrColorTaken) {
+		t.Fatalf("expected ErrColorTaken, got %v", err)
+	}
+	if err := g.SetProfile("a", "Alice", "#4f83ff"); err != nil {
+		t.Fatalf("failed to set a's profile: %v", err)
+	}
+	g.Tick()
+	if err := g.SetProfile("b", "Bob", ""); err != nil {
+		t.Fatalf("failed to set b's profile: %v", err)
+	}
+	g.Tick()
+
+	snapshot := g.CurrentSnapshot()
+	if a := snapshot.Players["a"]; a.DisplayName != "Alice" || a.Color != "#4f83ff" {
+		t.Fatalf("unexpected profile %+v", a)
+	}
+	if b := snapshot.Players["b"]; b.DisplayName != "Bob" || b.Color != "#222222" {
+		t.Fatalf("empty color must keep the current one, got %+v", b)
+	}
+
+	log, err := g.Recording()
+	if err != nil {
+		t.Fatalf("failed to read recording: %v", err)
+	}
+	if err := VerifyReplay(log); err != nil {
+		t.Fatalf("replay with profile changes failed: %v", err)
+	}
+}
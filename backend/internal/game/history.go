@@ -0,0 +1,274 @@
+package game
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrTickExpired  = errors.New("tick is no longer in history")
+	ErrTickInFuture = errors.New("tick has not happened yet")
+)
+
+// SnapshotDelta describes the changes between two snapshots. Resources move
+// almost every tick, so the full resource list is always included.
+type SnapshotDelta struct {
+	FromTick       int64             `json:"fromTick"`
+	Tick           int64             `json:"tick"`
+	Tiles          []Tile            `json:"tiles,omitempty"`
+	Players        map[string]Player `json:"players,omitempty"`
+	RemovedPlayers []string          `json:"removedPlayers,omitempty"`
+	Resources      []Resource        `json:"resources"`
+	// Teams, Winner and Agreements are always the values at Tick.
+	Teams      map[string]TeamScore `json:"teams,omitempty"`
+	Winner     *Winner              `json:"winner,omitempty"`
+	Agreements []Agreement          `json:"agreements,omitempty"`
+}
+
+func Diff(from, to GameSnapshot) SnapshotDelta {
+	delta := SnapshotDelta{
+		FromTick:   from.Tick,
+		Tick:       to.Tick,
+		Resources:  append([]Resource{}, to.Resources...),
+		Teams:      to.Teams,
+		Winner:     to.Winner,
+		Agreements: to.Agreements,
+	}
+
+	before := make(map[Position]Tile, len(from.Tiles))
+	for _, tile := range from.Tiles {
+		before[tile.Position] = tile
+	}
+	for _, tile := range to.Tiles {
+		if prev, ok := before[tile.Position]; ok && tilesEqual(prev, tile) {
+			continue
+		}
+		delta.Tiles = append(delta.Tiles, tile)
+	}
+
+	for id, player := range to.Players {
+		if prev, ok := from.Players[id]; ok && playersEqual(prev, player) {
+			continue
+		}
+		if delta.Players == nil {
+			delta.Players = make(map[string]Player)
+		}
+		delta.Players[id] = player
+	}
+	for id := range from.Players {
+		if _, ok := to.Players[id]; !ok {
+			delta.RemovedPlayers = append(delta.RemovedPlayers, id)
+		}
+	}
+
+	return delta
+}
+
+// Apply returns a new snapshot with the delta applied on top of base.
+func (d SnapshotDelta) Apply(base GameSnapshot) GameSnapshot {
+	next := GameSnapshot{
+		Tick:       d.Tick,
+		Width:      base.Width,
+		Height:     base.Height,
+		Players:    make(map[string]Player, len(base.Players)),
+		Tiles:      append([]Tile{}, base.Tiles...),
+		Resources:  append([]Resource{}, d.Resources...),
+		Teams:      d.Teams,
+		Winner:     d.Winner,
+		Agreements: d.Agreements,
+	}
+
+	for id, player := range base.Players {
+		next.Players[id] = player
+	}
+	for _, id := range d.RemovedPlayers {
+		delete(next.Players, id)
+	}
+	for id, player := range d.Players {
+		next.Players[id] = player
+	}
+
+	index := make(map[Position]int, len(next.Tiles))
+	for i, tile := range next.Tiles {
+		index[tile.Position] = i
+	}
+	for _, tile := range d.Tiles {
+		if i, ok := index[tile.Position]; ok {
+			next.Tiles[i] = tile
+		} else {
+			next.Tiles = append(next.Tiles, tile)
+		}
+	}
+
+	return next
+}
+
+func tilesEqual(a, b Tile) bool {
+	if a.Position != b.Position || a.OwnerID != b.OwnerID || a.Type != b.Type || a.HasResource != b.HasResource ||
+		a.CoreBorder != b.CoreBorder || a.ResourceBase != b.ResourceBase || a.DisconnectedSince != b.DisconnectedSince ||
+		len(a.Influence) != len(b.Influence) {
+		return false
+	}
+	for playerID, v := range a.Influence {
+		if w, ok := b.Influence[playerID]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+func playersEqual(a, b Player) bool {
+	if a.ID != b.ID || a.DisplayName != b.DisplayName || a.Team != b.Team || a.Color != b.Color ||
+		a.ResourceCount != b.ResourceCount || a.JoinedAtTick != b.JoinedAtTick {
+		return false
+	}
+	if len(a.CorePositions) != len(b.CorePositions) {
+		return false
+	}
+	for i := range a.CorePositions {
+		if a.CorePositions[i] != b.CorePositions[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// History keeps a bounded window of recent ticks: the snapshot of the oldest
+// tick in the window followed by one delta per tick up to the latest one.
+type History struct {
+	mu     sync.RWMutex
+	limit  int
+	base   *GameSnapshot
+	latest *GameSnapshot
+	deltas []SnapshotDelta
+}
+
+func NewHistory(limit int) *History {
+	if limit < 0 {
+		limit = 0
+	}
+	return &History{
+		limit:  limit,
+		deltas: make([]SnapshotDelta, 0, limit),
+	}
+}
+
+// SetLimit changes how many ticks of deltas are kept, dropping the oldest
+// ones if the window shrinks.
+func (h *History) SetLimit(limit int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if limit < 0 {
+		limit = 0
+	}
+	h.limit = limit
+	h.trimLocked()
+}
+
+// Reset forgets every recorded tick.
+func (h *History) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.base = nil
+	h.latest = nil
+	h.deltas = h.deltas[:0]
+}
+
+func (h *History) Record(snapshot GameSnapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	prev := h.latest
+	h.latest = &snapshot
+
+	if prev == nil || prev.Tick != snapshot.Tick-1 || prev.Width != snapshot.Width || prev.Height != snapshot.Height {
+		h.base = &snapshot
+		h.deltas = h.deltas[:0]
+		return
+	}
+
+	h.deltas = append(h.deltas, Diff(*prev, snapshot))
+	h.trimLocked()
+}
+
+func (h *History) trimLocked() {
+	drop := len(h.deltas) - h.limit
+	if drop <= 0 {
+		return
+	}
+
+	base := *h.base
+	for _, delta := range h.deltas[:drop] {
+		base = delta.Apply(base)
+	}
+	h.base = &base
+
+	copy(h.deltas, h.deltas[drop:])
+	h.deltas = h.deltas[:len(h.deltas)-drop]
+}
+
+// Range returns the oldest and latest tick that can be queried.
+func (h *History) Range() (oldest, latest int64, ok bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.latest == nil {
+		return 0, 0, false
+	}
+	return h.base.Tick, h.latest.Tick, true
+}
+
+// Since returns the deltas needed to bring a client that last saw tick up to
+// date. ErrTickExpired means the caller has to fall back to a full snapshot.
+func (h *History) Since(tick int64) ([]SnapshotDelta, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if err := h.checkLocked(tick); err != nil {
+		return nil, err
+	}
+
+	start := int(tick - h.base.Tick)
+	return append([]SnapshotDelta{}, h.deltas[start:]...), nil
+}
+
+// At rebuilds the snapshot of the given tick.
+func (h *History) At(tick int64) (GameSnapshot, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if err := h.checkLocked(tick); err != nil {
+		return GameSnapshot{}, err
+	}
+
+	snapshot := *h.base
+	for _, delta := range h.deltas[:tick-h.base.Tick] {
+		snapshot = delta.Apply(snapshot)
+	}
+	return snapshot, nil
+}
+
+// Between returns the changes from tick from to tick to.
+func (h *History) Between(from, to int64) (SnapshotDelta, error) {
+	before, err := h.At(from)
+	if err != nil {
+		return SnapshotDelta{}, err
+	}
+	after, err := h.At(to)
+	if err != nil {
+		return SnapshotDelta{}, err
+	}
+	return Diff(before, after), nil
+}
+
+func (h *History) checkLocked(tick int64) error {
+	if h.latest == nil || tick < h.base.Tick {
+		return ErrTickExpired
+	}
+	if tick > h.latest.Tick {
+		return ErrTickInFuture
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package game
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestHistoryDeltasRebuildLatestSnapshot(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	g := NewGameWithRand(8, 8, 4, rng)
+	if _, err := g.AddPlayerAt("player-1", Position{X: 1, Y: 1}, "#111111"); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+
+	history := NewHistory(5)
+	var base GameSnapshot
+	for i := 0; i < 8; i++ {
+		snapshot := g.Tick()
+		history.Record(snapshot)
+		if snapshot.Tick == 4 {
+			base = snapshot
+		}
+	}
+
+	deltas, err := history.Since(base.Tick)
+	if err != nil {
+		t.Fatalf("expected deltas since tick %d: %v", base.Tick, err)
+	}
+	if len(deltas) != 4 {
+		t.Fatalf("expected 4 deltas, got %d", len(deltas))
+	}
+
+	rebuilt := base
+	for _, delta := range deltas {
+		rebuilt = delta.Apply(rebuilt)
+	}
+
+	latest := g.CurrentSnapshot()
+	if diff := Diff(latest, rebuilt); len(diff.Tiles) != 0 || len(diff.Players) != 0 || len(diff.RemovedPlayers) != 0 {
+		t.Fatalf("rebuilt snapshot differs from latest: %+v", diff)
+	}
+
+	if _, err := history.Since(1); !errors.Is(err, ErrTickExpired) {
+		t.Fatalf("expected ErrTickExpired for aged out tick, got %v", err)
+	}
+	if _, err := history.Since(latest.Tick + 1); !errors.Is(err, ErrTickInFuture) {
+		t.Fatalf("expected ErrTickInFuture, got %v", err)
+	}
+}
+
+func TestSnapshotAtAndDiffTicks(t *testing.T) {
+	g := NewGameWithSeed(8, 8, 4, 13)
+	g.SetHistoryLimit(10)
+	if _, err := g.AddPlayerAt("player-1", Position{X: 4, Y: 4}, "#111111"); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+
+	snapshots := make(map[int64]GameSnapshot)
+	for i := 0; i < 25; i++ {
+		snapshot := g.Tick()
+		snapshots[snapshot.Tick] = snapshot
+	}
+
+	oldest, latest, ok := g.HistoryRange()
+	if !ok || oldest != 15 || latest != 25 {
+		t.Fatalf("expected history range 15-25, got %d-%d (%v)", oldest, latest, ok)
+	}
+
+	for _, tick := range []int64{15, 20, 25} {
+		got, err := g.SnapshotAt(tick)
+		if err != nil {
+			t.Fatalf("snapshot at %d failed: %v", tick, err)
+		}
+		if diff := Diff(snapshots[tick], got); got.Tick != tick || len(diff.Tiles) != 0 || len(diff.Players) != 0 {
+			t.Fatalf("snapshot at %d does not match the live snapshot", tick)
+		}
+	}
+
+	delta, err := g.DiffTicks(15, 25)
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	if rebuilt := delta.Apply(snapshots[15]); len(Diff(rebuilt, snapshots[25]).Tiles) != 0 {
+		t.Fatalf("applying the diff did not reach tick 25")
+	}
+
+	if _, err := g.SnapshotAt(14); !errors.Is(err, ErrTickExpired) {
+		t.Fatalf("expected ErrTickExpired, got %v", err)
+	}
+	if _, err := g.DiffTicks(20, 26); !errors.Is(err, ErrTickInFuture) {
+		t.Fatalf("expected ErrTickInFuture, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package game
+
+import "math"
+
+// InfluenceRules configure the influence spread rule, see InfluenceResolver.
+type InfluenceRules struct {
+	// Decay is the share of its influence a tile loses every tick.
+	Decay float64 `json:"decay"`
+	// Margin is the lead a side needs to take a tile.
+	Margin float64 `json:"margin"`
+}
+
+var DefaultInfluenceRules = InfluenceRules{Decay: 0.1, Margin: 2}
+
+// minInfluence is the influence below which a player's influence on a tile
+// is dropped. Influence is kept to three decimals so that snapshots stay
+// small.
+const minInfluence = 0.01
+
+func roundInfluence(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// decayInfluenceLocked lets the influence on every tile fade.
+func (g *Game) decayInfluenceLocked() {
+	keep := 1 - g.rules.Influence.Decay
+	for _, tile := range g.tiles {
+		for playerID, v := range tile.Influence {
+			if v = roundInfluence(v * keep); v < minInfluence {
+				delete(tile.Influence, playerID)
+			} else {
+				tile.Influence[playerID] = v
+			}
+		}
+		if len(tile.Influence) == 0 {
+			tile.Influence = nil
+		}
+	}
+}
+
+func cloneInfluence(influence map[string]float64) map[string]float64 {
+	if influence == nil {
+		return nil
+	}
+	clone := make(map[string]float64, len(influence))
+	for playerID, v := range influence {
+		clone[playerID] = v
+	}
+	return clone
+}
+
+func cloneTile(tile *Tile) Tile {
+	copy := *tile
+	copy.Influence = cloneInfluence(tile.Influence)
+	return copy
+}
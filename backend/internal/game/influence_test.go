@@ -0,0 +1,80 @@
+package game
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestInfluenceNeedsToLeadByTheMargin(t *testing.T) {
+	g := NewGameWithSeed(8, 3, 0, 1)
+	g.SetRules(Rules{Influence: &InfluenceRules{Decay: 0.25, Margin: 2}})
+	g.AddPlayerAt("a", Position{X: 0, Y: 1}, "#ff0000")
+	next := posKey(Position{X: 1, Y: 1})
+
+	g.Tick()
+	g.Tick()
+	if tile := g.tiles[next]; tile.OwnerID != "" || tile.Influence["a"] != 1.75 {
+		t.Fatalf("expected 1.75 influence and no owner yet, got %+v", tile)
+	}
+
+	snapshot := g.Tick()
+	if tile := g.tiles[next]; tile.OwnerID != "a" {
+		t.Fatalf("expected a to take the tile once past the margin, got %+v", tile)
+	}
+	for _, tile := range snapshot.Tiles {
+		if tile.Position == (Position{X: 1, Y: 1}) && tile.Influence["a"] <= 2 {
+			t.Fatalf("expected the snapshot to carry the influence, got %+v", tile)
+		}
+	}
+}
+
+func TestInfluenceDecays(t *testing.T) {
+	g := NewGameWithSeed(4, 4, 0, 1)
+	g.SetRules(Rules{Influence: &InfluenceRules{Decay: 0.5}})
+	tile := g.tiles[posKey(Position{X: 2, Y: 2})]
+	tile.Influence = map[string]float64{"a": 3, "b": 0.015}
+
+	g.decayInfluenceLocked()
+	if len(tile.Influence) != 1 || tile.Influence["a"] != 1.5 {
+		t.Fatalf("expected b's influence to fade out and a's to halve, got %v", tile.Influence)
+	}
+
+	g.SetRules(Rules{})
+	if tile.Influence != nil {
+		t.Fatalf("expected influence to be dropped with the influence rules, got %v", tile.Influence)
+	}
+}
+
+func TestInfluenceGameSavesAndReplays(t *testing.T) {
+	g := NewGameWithSeed(12, 12, 6, 5)
+	if err := g.StartRecording("influence"); err != nil {
+		t.Fatal(err)
+	}
+	rules := DefaultInfluenceRules
+	g.SetRules(Rules{Influence: &rules})
+	g.AddPlayer("a")
+	g.AddPlayer("b")
+	for i := 0; i < 30; i++ {
+		g.Tick()
+	}
+
+	var buf bytes.Buffer
+	if err := g.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.StateHash() != g.StateHash() {
+		t.Fatal("loaded game does not match the saved one")
+	}
+
+	log, err := g.Recording()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyReplay(log); err != nil {
+		t.Fatal(err)
+	}
+}
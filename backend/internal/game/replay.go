@@ -0,0 +1,480 @@
+package game
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
+	"strconv"
+)
+
+// ReplayVersion is the version of the ReplayLog format.
+const ReplayVersion = 1
+
+var (
+	ErrNotRecording   = errors.New("game is not being recorded")
+	ErrReplayDiverged = errors.New("replay diverged from recording")
+	ErrReplayFinished = errors.New("replay has no more ticks")
+	ErrTickOutOfRange = errors.New("tick is outside of the replay")
+)
+
+// replayKeyframeEvery is how often the replayer keeps a copy of the state so
+// that seeking backwards does not have to re-simulate from the start.
+const replayKeyframeEvery = 100
+
+type ReplayEventKind string
+
+const (
+	EventJoin               ReplayEventKind = "join"
+	EventLeave              ReplayEventKind = "leave"
+	EventPlaceCore          ReplayEventKind = "placeCore"
+	EventRemoveCore         ReplayEventKind = "removeCore"
+	EventPlaceResourceBase  ReplayEventKind = "placeResourceBase"
+	EventRemoveResourceBase ReplayEventKind = "removeResourceBase"
+	EventProfile            ReplayEventKind = "profile"
+	EventColorRules         ReplayEventKind = "colorRules"
+	EventRules              ReplayEventKind = "rules"
+	EventTeam               ReplayEventKind = "team"
+	EventAgreement          ReplayEventKind = "agreement"
+	EventBreakAgreement     ReplayEventKind = "breakAgreement"
+)
+
+// ReplayEvent is an input that changed the game between two ticks. It is
+// applied after tick Tick has run and before tick Tick+1.
+type ReplayEvent struct {
+	Tick     int64           `json:"tick"`
+	Kind     ReplayEventKind `json:"kind"`
+	PlayerID string          `json:"playerId,omitempty"`
+	Position *Position       `json:"position,omitempty"`
+	Color    string          `json:"color,omitempty"`
+	// DisplayName is set by profile events.
+	DisplayName string `json:"displayName,omitempty"`
+	// Colors and MinColorDistance are set by color rules events.
+	Colors           []string `json:"colors,omitempty"`
+	MinColorDistance float64  `json:"minColorDistance,omitempty"`
+	// Rules is set by rules events and Team by team events.
+	Rules *Rules `json:"rules,omitempty"`
+	Team  string `json:"team,omitempty"`
+	// Agreement is set by agreement events and AgreementID by break events.
+	Agreement   *Agreement `json:"agreement,omitempty"`
+	AgreementID string     `json:"agreementId,omitempty"`
+}
+
+type ReplayConfig struct {
+	Width         int `json:"width"`
+	Height        int `json:"height"`
+	ResourceBases int `json:"resourceBases"`
+}
+
+// ReplayLog is everything needed to re-simulate a match: the state it
+// started from, every input by tick and the state hash after every tick.
+type ReplayLog struct {
+	Version   int             `json:"version"`
+	ID        string          `json:"id"`
+	Seed      int64           `json:"seed"`
+	Config    ReplayConfig    `json:"config"`
+	StartTick int64           `json:"startTick"`
+	Start     json.RawMessage `json:"start"`
+	Events    []ReplayEvent   `json:"events"`
+	// Hashes[i] is the state hash after tick StartTick+i+1.
+	Hashes []string `json:"hashes"`
+	// Continues is the id of the recording this one picks up from when a
+	// long match is recorded in segments, see RotateRecording.
+	Continues string `json:"continues,omitempty"`
+}
+
+// EndTick is the last tick covered by the log.
+func (l ReplayLog) EndTick() int64 {
+	return l.StartTick + int64(len(l.Hashes))
+}
+
+func (l ReplayLog) clone() ReplayLog {
+	l.Start = append(json.RawMessage(nil), l.Start...)
+	l.Events = append([]ReplayEvent(nil), l.Events...)
+	l.Hashes = append([]string(nil), l.Hashes...)
+	return l
+}
+
+// StartRecording begins a new recording with the given id, replacing any
+// recording in progress.
+func (g *Game) StartRecording(id string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.startRecordingLocked(id)
+}
+
+// RotateRecording ends the recording in progress and returns it, and keeps
+// recording under id from the current state. Nothing can happen in between,
+// so the segments cover the match without gaps.
+func (g *Game) RotateRecording(id string) (ReplayLog, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.recording == nil {
+		return ReplayLog{}, ErrNotRecording
+	}
+	finished := g.recording
+	if err := g.startRecordingLocked(id); err != nil {
+		return ReplayLog{}, err
+	}
+	g.recording.Continues = finished.ID
+	return *finished, nil
+}
+
+// RecordingTicks returns how many ticks the recording in progress covers.
+func (g *Game) RecordingTicks() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if g.recording == nil {
+		return 0
+	}
+	return len(g.recording.Hashes)
+}
+
+func (g *Game) startRecordingLocked(id string) error {
+	state, err := g.stateLocked()
+	if err != nil {
+		return err
+	}
+	start, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	g.recording = &ReplayLog{
+		Version: ReplayVersion,
+		ID:      id,
+		Seed:    g.seed,
+		Config: ReplayConfig{
+			Width:         g.width,
+			Height:        g.height,
+			ResourceBases: len(g.resourceTiles),
+		},
+		StartTick: g.tick,
+		Start:     start,
+		Events:    []ReplayEvent{},
+		Hashes:    []string{},
+	}
+	return nil
+}
+
+// Recording returns a copy of the recording in progress.
+func (g *Game) Recording() (ReplayLog, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if g.recording == nil {
+		return ReplayLog{}, ErrNotRecording
+	}
+	return g.recording.clone(), nil
+}
+
+func (g *Game) recordLocked(event ReplayEvent) {
+	if g.recording == nil {
+		return
+	}
+	event.Tick = g.tick
+	g.recording.Events = append(g.recording.Events, event)
+}
+
+// StateHash returns a hash of the complete game state. Two games with the
+// same hash behave identically from then on.
+func (g *Game) StateHash() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.hashLocked()
+}
+
+func (g *Game) hashLocked() string {
+	h := fnv.New64a()
+	writeInt(h, g.tick)
+	writeInt(h, int64(g.nextResourceID))
+
+	for _, pos := range g.positionsLocked() {
+		key := posKey(pos)
+		tile := g.tiles[key]
+		writeString(h, tile.OwnerID)
+		writeString(h, string(tile.Type))
+		writeBool(h, tile.HasResource)
+		writeBool(h, tile.CoreBorder)
+		writeBool(h, tile.ResourceBase)
+		writeBool(h, g.resourceTiles[key])
+		writeInt(h, tile.DisconnectedSince)
+		for _, playerID := range sortedKeys(tile.Influence) {
+			writeString(h, playerID)
+			writeInt(h, int64(math.Float64bits(tile.Influence[playerID])))
+		}
+
+		bucket := g.pendingSpreads[key]
+		for _, playerID := range sortedKeys(bucket) {
+			writeString(h, playerID)
+			for _, originKey := range sortedKeys(bucket[playerID]) {
+				writeString(h, originKey)
+			}
+		}
+		writeString(h, "|")
+	}
+
+	for _, id := range g.sortedPlayerIDsLocked() {
+		player := g.players[id]
+		writeString(h, player.ID)
+		writeString(h, player.DisplayName)
+		writeString(h, player.Color)
+		writeString(h, player.Team)
+		writeInt(h, int64(player.ResourceCount))
+		writeInt(h, player.JoinedAtTick)
+		for _, core := range player.CorePositions {
+			writeInt(h, int64(core.X))
+			writeInt(h, int64(core.Y))
+		}
+	}
+
+	for _, id := range g.sortedResourceIDsLocked() {
+		res := g.resources[id]
+		writeString(h, res.ID)
+		writeString(h, res.OwnerID)
+		writeInt(h, int64(res.Position.X))
+		writeInt(h, int64(res.Position.Y))
+	}
+
+	for _, playerID := range sortedKeys(g.rules.Teams) {
+		writeString(h, playerID)
+		writeString(h, g.rules.Teams[playerID])
+	}
+	writeBool(h, g.rules.FixedTeams)
+	writeInt(h, int64(g.rules.WinTerritoryPercent))
+	writeInt(h, int64(g.rules.WinResources))
+	writeString(h, g.rules.SpreadRule)
+	writeInt(h, int64(g.rules.SupplyGraceTicks))
+	if influence := g.rules.Influence; influence != nil {
+		writeInt(h, int64(math.Float64bits(influence.Decay)))
+		writeInt(h, int64(math.Float64bits(influence.Margin)))
+	}
+	if g.winner != nil {
+		writeString(h, g.winner.Team)
+		writeString(h, g.winner.Reason)
+		writeInt(h, g.winner.Tick)
+		for _, id := range g.winner.PlayerIDs {
+			writeString(h, id)
+		}
+	}
+
+	for _, color := range g.colorPool {
+		writeString(h, color)
+	}
+	writeInt(h, int64(math.Float64bits(g.minColorDistance)))
+
+	writeInt(h, int64(g.nextAgreementID))
+	for _, agreement := range g.agreements {
+		writeString(h, agreement.ID)
+		writeString(h, string(agreement.Kind))
+		writeString(h, agreement.Players[0])
+		writeString(h, agreement.Players[1])
+		writeInt(h, agreement.StartTick)
+		writeInt(h, agreement.EndTick)
+		writeInt(h, int64(agreement.Penalty))
+	}
+
+	for _, name := range rngStreams {
+		state, _ := g.rand.sources[name].MarshalBinary()
+		h.Write(state)
+	}
+
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+func writeInt(h hash.Hash64, v int64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(v))
+	h.Write(buf[:])
+}
+
+func writeString(h hash.Hash64, s string) {
+	writeInt(h, int64(len(s)))
+	h.Write([]byte(s))
+}
+
+func writeBool(h hash.Hash64, b bool) {
+	if b {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+}
+
+// Replayer re-simulates a recorded match tick by tick and checks every tick
+// against the recorded hash.
+type Replayer struct {
+	log       ReplayLog
+	game      *Game
+	nextEvent int
+	keyframes map[int64]replayKeyframe
+}
+
+type replayKeyframe struct {
+	state     []byte
+	nextEvent int
+}
+
+func NewReplayer(log ReplayLog) (*Replayer, error) {
+	if log.Version != ReplayVersion {
+		return nil, fmt.Errorf("unsupported replay version %d", log.Version)
+	}
+
+	g, err := Load(bytes.NewReader(log.Start))
+	if err != nil {
+		return nil, fmt.Errorf("load replay start: %w", err)
+	}
+
+	return &Replayer{
+		log:  log,
+		game: g,
+		keyframes: map[int64]replayKeyframe{
+			log.StartTick: {state: log.Start},
+		},
+	}, nil
+}
+
+func (r *Replayer) Log() ReplayLog {
+	return r.log
+}
+
+func (r *Replayer) Tick() int64 {
+	return r.game.CurrentSnapshot().Tick
+}
+
+func (r *Replayer) Done() bool {
+	return r.Tick() >= r.log.EndTick()
+}
+
+func (r *Replayer) Snapshot() GameSnapshot {
+	return r.game.CurrentSnapshot()
+}
+
+// Step applies the inputs recorded for the current tick and advances the
+// game by one tick.
+func (r *Replayer) Step() (GameSnapshot, error) {
+	tick := r.Tick()
+	if tick >= r.log.EndTick() {
+		return GameSnapshot{}, ErrReplayFinished
+	}
+
+	for r.nextEvent < len(r.log.Events) && r.log.Events[r.nextEvent].Tick <= tick {
+		if err := r.game.applyReplayEvent(r.log.Events[r.nextEvent]); err != nil {
+			return GameSnapshot{}, fmt.Errorf("apply event at tick %d: %w", tick, err)
+		}
+		r.nextEvent++
+	}
+
+	snapshot := r.game.Tick()
+
+	want := r.log.Hashes[snapshot.Tick-r.log.StartTick-1]
+	if got := r.game.StateHash(); got != want {
+		return snapshot, fmt.Errorf("%w at tick %d: got %s, want %s", ErrReplayDiverged, snapshot.Tick, got, want)
+	}
+
+	if snapshot.Tick%replayKeyframeEvery == 0 {
+		if _, ok := r.keyframes[snapshot.Tick]; !ok {
+			var buf bytes.Buffer
+			if err := r.game.Save(&buf); err == nil {
+				r.keyframes[snapshot.Tick] = replayKeyframe{state: buf.Bytes(), nextEvent: r.nextEvent}
+			}
+		}
+	}
+
+	return snapshot, nil
+}
+
+// SeekTick moves the replay to the given tick. Seeking backwards restarts from
+// the closest keyframe at or before the tick.
+func (r *Replayer) SeekTick(tick int64) (GameSnapshot, error) {
+	if tick < r.log.StartTick || tick > r.log.EndTick() {
+		return GameSnapshot{}, fmt.Errorf("%w: %d not in [%d, %d]", ErrTickOutOfRange, tick, r.log.StartTick, r.log.EndTick())
+	}
+
+	if tick < r.Tick() {
+		best := r.log.StartTick
+		for keyTick := range r.keyframes {
+			if keyTick <= tick && keyTick > best {
+				best = keyTick
+			}
+		}
+
+		keyframe := r.keyframes[best]
+		g, err := Load(bytes.NewReader(keyframe.state))
+		if err != nil {
+			return GameSnapshot{}, fmt.Errorf("load keyframe at tick %d: %w", best, err)
+		}
+		r.game = g
+		r.nextEvent = keyframe.nextEvent
+	}
+
+	for r.Tick() < tick {
+		if _, err := r.Step(); err != nil {
+			return GameSnapshot{}, err
+		}
+	}
+
+	return r.Snapshot(), nil
+}
+
+// VerifyReplay re-simulates the whole log and reports the first tick whose
+// state does not match the recording.
+func VerifyReplay(log ReplayLog) error {
+	r, err := NewReplayer(log)
+	if err != nil {
+		return err
+	}
+	for !r.Done() {
+		if _, err := r.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Game) applyReplayEvent(event ReplayEvent) error {
+	switch event.Kind {
+	case EventJoin:
+		var err error
+		if event.Position != nil {
+			_, err = g.AddPlayerAt(event.PlayerID, *event.Position, event.Color)
+		} else {
+			_, err = g.AddPlayer(event.PlayerID)
+		}
+		return err
+	case EventLeave:
+		g.RemovePlayer(event.PlayerID)
+		return nil
+	case EventProfile:
+		return g.SetProfile(event.PlayerID, event.DisplayName, event.Color)
+	case EventColorRules:
+		return g.SetColorRules(event.Colors, event.MinColorDistance)
+	case EventRules:
+		if event.Rules == nil {
+			return fmt.Errorf("%s event without rules", event.Kind)
+		}
+		return g.SetRules(*event.Rules)
+	case EventTeam:
+		return g.SetTeam(event.PlayerID, event.Team)
+	case EventAgreement:
+		if event.Agreement == nil {
+			return fmt.Errorf("%s event without agreement", event.Kind)
+		}
+		a := event.Agreement
+		_, err := g.MakeAgreement(a.Kind, a.Players[0], a.Players[1], a.EndTick-a.StartTick, a.Penalty)
+		return err
+	case EventBreakAgreement:
+		_, err := g.BreakAgreement(event.AgreementID, event.PlayerID)
+		return err
+	default:
+		return g.applyAdminEvent(event)
+	}
+}
@@ -0,0 +1,183 @@
+package game
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSeededGamesAreDeterministic(t *testing.T) {
+	a := NewGameWithSeed(16, 16, 20, 5)
+	b := NewGameWithSeed(16, 16, 20, 5)
+
+	for _, g := range []*Game{a, b} {
+		for _, id := range []string{"player-1", "player-2", "player-3"} {
+			if _, err := g.AddPlayer(id); err != nil {
+				t.Fatalf("failed to add player: %v", err)
+			}
+		}
+	}
+
+	for i := 0; i < 30; i++ {
+		a.Tick()
+		b.Tick()
+		if ha, hb := a.StateHash(), b.StateHash(); ha != hb {
+			t.Fatalf("states diverged at tick %d: %s != %s", i+1, ha, hb)
+		}
+	}
+}
+
+func TestStateHashCoversProfilesTeamsAndColors(t *testing.T) {
+	g := NewGameWithSeed(8, 8, 4, 3)
+	if _, err := g.AddPlayer("player-1"); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+
+	changes := []struct {
+		name   string
+		change func() error
+	}{
+		{"display name", func() error { return g.SetProfile("player-1", "Ada", "") }},
+		{"team assignment of an absent player", func() error { return g.SetRules(Rules{Teams: map[string]string{"player-9": "red"}}) }},
+		{"fixed teams", func() error { return g.SetRules(Rules{Teams: map[string]string{"player-9": "red"}, FixedTeams: true}) }},
+		{"color pool", func() error { return g.SetColorRules([]string{"#ff0000", "#0000ff"}, g.MinColorDistance()) }},
+		{"min color distance", func() error { return g.SetColorRules(nil, g.MinColorDistance()+1) }},
+	}
+	for _, c := range changes {
+		before := g.StateHash()
+		if err := c.change(); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if g.StateHash() == before {
+			t.Fatalf("expected a change of the %s to change the state hash", c.name)
+		}
+	}
+}
+
+func TestReplayReproducesRecording(t *testing.T) {
+	g := NewGameWithSeed(12, 12, 10, 21)
+	if _, err := g.AddPlayer("player-1"); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+	g.Tick()
+
+	if err := g.StartRecording("match-1"); err != nil {
+		t.Fatalf("failed to start recording: %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		switch i {
+		case 3:
+			if _, err := g.AddPlayer("player-2"); err != nil {
+				t.Fatalf("failed to add player: %v", err)
+			}
+		case 8:
+			if _, err := g.AddPlayerAt("player-3", Position{X: 10, Y: 10}, ""); err != nil {
+				t.Fatalf("failed to add player: %v", err)
+			}
+		case 14:
+			g.RemovePlayer("player-2")
+		}
+		g.Tick()
+	}
+
+	log, err := g.Recording()
+	if err != nil {
+		t.Fatalf("failed to read recording: %v", err)
+	}
+	if len(log.Events) != 3 || len(log.Hashes) != 20 {
+		t.Fatalf("expected 3 events and 20 hashes, got %d and %d", len(log.Events), len(log.Hashes))
+	}
+
+	if err := VerifyReplay(log); err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+
+	log.Hashes[10] = "tampered"
+	if err := VerifyReplay(log); !errors.Is(err, ErrReplayDiverged) {
+		t.Fatalf("expected ErrReplayDiverged, got %v", err)
+	}
+}
+
+func TestReplayerSeek(t *testing.T) {
+	g := NewGameWithSeed(10, 10, 6, 8)
+	if err := g.StartRecording("match-seek"); err != nil {
+		t.Fatalf("failed to start recording: %v", err)
+	}
+	if _, err := g.AddPlayer("player-1"); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+
+	hashes := make(map[int64]string)
+	for i := 0; i < 250; i++ {
+		snapshot := g.Tick()
+		hashes[snapshot.Tick] = g.StateHash()
+	}
+
+	log, err := g.Recording()
+	if err != nil {
+		t.Fatalf("failed to read recording: %v", err)
+	}
+
+	r, err := NewReplayer(log)
+	if err != nil {
+		t.Fatalf("failed to create replayer: %v", err)
+	}
+
+	for _, tick := range []int64{230, 120, 5, 250, 0} {
+		snapshot, err := r.SeekTick(tick)
+		if err != nil {
+			t.Fatalf("seek to %d failed: %v", tick, err)
+		}
+		if snapshot.Tick != tick {
+			t.Fatalf("expected tick %d after seek, got %d", tick, snapshot.Tick)
+		}
+		if want, ok := hashes[tick]; ok && r.game.StateHash() != want {
+			t.Fatalf("state after seeking to %d does not match recording", tick)
+		}
+	}
+
+	if _, err := r.SeekTick(251); !errors.Is(err, ErrTickOutOfRange) {
+		t.Fatalf("expected ErrTickOutOfRange, got %v", err)
+	}
+}
+
+func TestRotateRecordingSplitsTheMatch(t *testing.T) {
+	g := NewGameWithSeed(10, 10, 6, 12)
+	if _, err := g.RotateRecording("match-2"); !errors.Is(err, ErrNotRecording) {
+		t.Fatalf("expected ErrNotRecording, got %v", err)
+	}
+	if err := g.StartRecording("match-1"); err != nil {
+		t.Fatalf("failed to start recording: %v", err)
+	}
+	if _, err := g.AddPlayer("player-1"); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+	for i := 0; i < 6; i++ {
+		g.Tick()
+	}
+
+	first, err := g.RotateRecording("match-2")
+	if err != nil {
+		t.Fatalf("failed to rotate recording: %v", err)
+	}
+	if _, err := g.AddPlayer("player-2"); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		g.Tick()
+	}
+	second, err := g.Recording()
+	if err != nil {
+		t.Fatalf("failed to read recording: %v", err)
+	}
+
+	if first.EndTick() != 6 || g.RecordingTicks() != 4 || second.StartTick != first.EndTick() || second.Continues != "match-1" {
+		t.Fatalf("expected back to back segments, got ticks %d-%d and %d-%d continuing %q",
+			first.StartTick, first.EndTick(), second.StartTick, second.EndTick(), second.Continues)
+	}
+	for _, log := range []ReplayLog{first, second} {
+		if err := VerifyReplay(log); err != nil {
+			t.Fatalf("%s: replay failed: %v", log.ID, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package game
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	randv2 "math/rand/v2"
+)
+
+// rngStream names one of the independent random number generators of a game.
+// Each subsystem draws from its own stream, so that an extra draw in one of
+// them (a colour pick, say) never shifts the outcome of another (where the
+// next core is placed).
+type rngStream string
+
+const (
+	streamMap    rngStream = "map"
+	streamSpawn  rngStream = "spawn"
+	streamColor  rngStream = "color"
+	streamSpread rngStream = "spread"
+)
+
+var rngStreams = []rngStream{streamMap, streamSpawn, streamColor, streamSpread}
+
+// randomStreams holds one generator per stream.
+type randomStreams struct {
+	rngs    map[rngStream]*rand.Rand
+	sources map[rngStream]*pcgSource
+}
+
+func seededStreams(seed int64) randomStreams {
+	streams := randomStreams{
+		rngs:    make(map[rngStream]*rand.Rand, len(rngStreams)),
+		sources: make(map[rngStream]*pcgSource, len(rngStreams)),
+	}
+	for _, name := range rngStreams {
+		source := newPCGSource(uint64(seed), streamSalt(name))
+		streams.sources[name] = source
+		streams.rngs[name] = rand.New(source)
+	}
+	return streams
+}
+
+// restoreStreams continues saved streams. Streams added after the state was
+// saved start from the game's seed.
+func restoreStreams(states map[rngStream][]byte, seed int64) (randomStreams, error) {
+	streams := seededStreams(seed)
+	for _, name := range rngStreams {
+		state, ok := states[name]
+		if !ok {
+			if name == streamSpread {
+				continue
+			}
+			return randomStreams{}, fmt.Errorf("missing rng stream %q", name)
+		}
+		if err := streams.sources[name].UnmarshalBinary(state); err != nil {
+			return randomStreams{}, fmt.Errorf("restore rng stream %q: %w", name, err)
+		}
+	}
+	return streams, nil
+}
+
+func (r randomStreams) get(name rngStream) *rand.Rand {
+	return r.rngs[name]
+}
+
+func (r randomStreams) marshal() (map[rngStream][]byte, error) {
+	states := make(map[rngStream][]byte, len(r.sources))
+	for name, source := range r.sources {
+		state, err := source.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("save rng stream %q: %w", name, err)
+		}
+		states[name] = state
+	}
+	return states, nil
+}
+
+func streamSalt(name rngStream) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return h.Sum64()
+}
+
+// pcgSource adapts a PCG generator to math/rand's Source64. Unlike the
+// default math/rand source its position can be marshalled, which lets a
+// saved game continue with exactly the same random sequence.
+type pcgSource struct {
+	pcg  *randv2.PCG
+	salt uint64
+}
+
+func newPCGSource(seed, salt uint64) *pcgSource {
+	return &pcgSource{pcg: randv2.NewPCG(seed, salt), salt: salt}
+}
+
+func (s *pcgSource) Int63() int64 {
+	return int64(s.pcg.Uint64() >> 1)
+}
+
+func (s *pcgSource) Uint64() uint64 {
+	return s.pcg.Uint64()
+}
+
+func (s *pcgSource) Seed(seed int64) {
+	s.pcg.Seed(uint64(seed), s.salt)
+}
+
+func (s *pcgSource) MarshalBinary() ([]byte, error) {
+	return s.pcg.MarshalBinary()
+}
+
+func (s *pcgSource) UnmarshalBinary(data []byte) error {
+	return s.pcg.UnmarshalBinary(data)
+}
@@ -0,0 +1,92 @@
+package game
+
+// Rules are the per-match settings that change how the game plays.
+type Rules struct {
+	// Teams assigns players to teams when they join, by player id.
+	Teams map[string]string `json:"teams,omitempty"`
+	// FixedTeams keeps players from changing teams during the match.
+	FixedTeams bool `json:"fixedTeams,omitempty"`
+	// WinTerritoryPercent ends the match once a side holds this share of the
+	// board. Zero disables it.
+	WinTerritoryPercent int `json:"winTerritoryPercent,omitempty"`
+	// WinResources ends the match once a side has collected this many
+	// resources. Zero disables it.
+	WinResources int `json:"winResources,omitempty"`
+	// SupplyGraceTicks turns tiles that have been cut off from their side's
+	// cores for this many ticks neutral. Zero disables it.
+	SupplyGraceTicks int `json:"supplyGraceTicks,omitempty"`
+	// SpreadRule names the rule that decides contested tiles, one of
+	// SpreadRules. Empty plays as the majority rule.
+	SpreadRule string `json:"spreadRule,omitempty"`
+	// Influence configures the influence rule. Setting it without a spread
+	// rule selects the influence rule.
+	Influence *InfluenceRules `json:"influence,omitempty"`
+}
+
+func (r Rules) clone() Rules {
+	if r.Teams != nil {
+		teams := make(map[string]string, len(r.Teams))
+		for playerID, team := range r.Teams {
+			teams[playerID] = team
+		}
+		r.Teams = teams
+	}
+	if r.Influence != nil {
+		influence := *r.Influence
+		r.Influence = &influence
+	}
+	return r
+}
+
+// normalized makes SpreadRule and Influence agree: influence settings only
+// exist under the influence rule, which falls back to the default settings.
+func (r Rules) normalized() Rules {
+	switch {
+	case r.SpreadRule == "" && r.Influence != nil:
+		r.SpreadRule = SpreadInfluence
+	case r.SpreadRule == SpreadInfluence && r.Influence == nil:
+		influence := DefaultInfluenceRules
+		r.Influence = &influence
+	case r.SpreadRule != SpreadInfluence:
+		r.Influence = nil
+	}
+	return r
+}
+
+// SetRules replaces the rules. Players listed in the new team assignments
+// move to their team right away. It returns ErrUnknownSpreadRule and keeps the
+// old rules when the spread rule is not one of SpreadRules.
+func (g *Game) SetRules(rules Rules) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	rules = rules.clone().normalized()
+	resolver, err := NewSpreadResolver(rules)
+	if err != nil {
+		return err
+	}
+	g.recordLocked(ReplayEvent{Kind: EventRules, Rules: &rules})
+	g.rules = rules
+	g.resolver = resolver
+	for _, tile := range g.tiles {
+		if rules.Influence == nil {
+			tile.Influence = nil
+		}
+		if rules.SupplyGraceTicks <= 0 {
+			tile.DisconnectedSince = 0
+		}
+	}
+	for _, id := range g.sortedPlayerIDsLocked() {
+		if team, ok := rules.Teams[id]; ok {
+			g.players[id].Team = team
+		}
+	}
+	return nil
+}
+
+// Rules returns the current rules.
+func (g *Game) Rules() Rules {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.rules.clone()
+}
@@ -0,0 +1,229 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// MinTickInterval is the shortest interval a Runner accepts.
+const MinTickInterval = 10 * time.Millisecond
+
+// runnerTPSWindow is the number of recent ticks used to measure the actual
+// tick rate.
+const runnerTPSWindow = 20
+
+var (
+	ErrRunnerNotPaused     = errors.New("runner must be paused to step")
+	ErrInvalidTickInterval = errors.New("tick interval is too short")
+)
+
+// RunnerStats describes how the tick loop is doing.
+type RunnerStats struct {
+	Running          bool
+	Paused           bool
+	Tick             int64
+	TickInterval     time.Duration
+	TicksPerSecond   float64
+	Overruns         int64
+	LastTickDuration time.Duration
+}
+
+// Runner drives a game's tick loop. It can be paused, resumed, stepped one
+// tick at a time while paused and sped up or slowed down while running.
+type Runner struct {
+	game *Game
+
+	// OnTick is called after every tick, including ticks run by StepOnce.
+	OnTick func(GameSnapshot)
+	// OnOverrun is called when a tick took longer than the tick interval.
+	OnOverrun func(tick int64, took, interval time.Duration)
+
+	// tickMu serialises ticks from the loop and from StepOnce.
+	tickMu sync.Mutex
+
+	mu           sync.Mutex
+	interval     time.Duration
+	paused       bool
+	running      bool
+	changed      chan struct{}
+	tickTimes    []time.Time
+	overruns     int64
+	lastDuration time.Duration
+}
+
+func NewRunner(g *Game, interval time.Duration) *Runner {
+	if interval < MinTickInterval {
+		interval = MinTickInterval
+	}
+	return &Runner{
+		game:     g,
+		interval: interval,
+		changed:  make(chan struct{}, 1),
+	}
+}
+
+// Run ticks the game until ctx is cancelled. A tick that is in progress when
+// ctx is cancelled always runs to completion.
+func (r *Runner) Run(ctx context.Context) {
+	r.mu.Lock()
+	r.running = true
+	interval := r.interval
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		r.running = false
+		r.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.changed:
+			r.mu.Lock()
+			interval = r.interval
+			r.mu.Unlock()
+			resetTimer(timer, interval)
+		case <-timer.C:
+			r.mu.Lock()
+			paused := r.paused
+			interval = r.interval
+			r.mu.Unlock()
+
+			if paused {
+				continue
+			}
+
+			started := time.Now()
+			r.tick()
+			// Overrunning ticks are not caught up on; the next tick simply
+			// starts right away.
+			resetTimer(timer, max(interval-time.Since(started), 0))
+		}
+	}
+}
+
+// Pause stops the loop after the tick in progress, if any.
+func (r *Runner) Pause() {
+	r.mu.Lock()
+	r.paused = true
+	r.tickTimes = r.tickTimes[:0]
+	r.mu.Unlock()
+	r.notify()
+}
+
+// Resume restarts a paused loop. The next tick runs one interval later.
+func (r *Runner) Resume() {
+	r.mu.Lock()
+	r.paused = false
+	r.tickTimes = r.tickTimes[:0]
+	r.mu.Unlock()
+	r.notify()
+}
+
+// SetTickInterval changes the time between ticks, taking effect right away.
+func (r *Runner) SetTickInterval(interval time.Duration) error {
+	if interval < MinTickInterval {
+		return ErrInvalidTickInterval
+	}
+
+	r.mu.Lock()
+	r.interval = interval
+	r.tickTimes = r.tickTimes[:0]
+	r.mu.Unlock()
+	r.notify()
+	return nil
+}
+
+// TickInterval returns the current interval between ticks.
+func (r *Runner) TickInterval() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.interval
+}
+
+// StepOnce runs a single tick while the runner is paused.
+func (r *Runner) StepOnce() (GameSnapshot, error) {
+	r.mu.Lock()
+	paused := r.paused
+	r.mu.Unlock()
+
+	if !paused {
+		return GameSnapshot{}, ErrRunnerNotPaused
+	}
+	return r.tick(), nil
+}
+
+func (r *Runner) Stats() RunnerStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := RunnerStats{
+		Running:          r.running,
+		Paused:           r.paused,
+		Tick:             r.game.CurrentTick(),
+		TickInterval:     r.interval,
+		Overruns:         r.overruns,
+		LastTickDuration: r.lastDuration,
+	}
+	if n := len(r.tickTimes); !r.paused && n > 1 {
+		if elapsed := r.tickTimes[n-1].Sub(r.tickTimes[0]); elapsed > 0 {
+			stats.TicksPerSecond = float64(n-1) / elapsed.Seconds()
+		}
+	}
+	return stats
+}
+
+func (r *Runner) tick() GameSnapshot {
+	r.tickMu.Lock()
+	defer r.tickMu.Unlock()
+
+	started := time.Now()
+	snapshot := r.game.Tick()
+	took := time.Since(started)
+
+	r.mu.Lock()
+	interval := r.interval
+	r.lastDuration = took
+	if len(r.tickTimes) == runnerTPSWindow {
+		copy(r.tickTimes, r.tickTimes[1:])
+		r.tickTimes = r.tickTimes[:runnerTPSWindow-1]
+	}
+	r.tickTimes = append(r.tickTimes, started)
+	overrun := took > interval
+	if overrun {
+		r.overruns++
+	}
+	r.mu.Unlock()
+
+	if overrun && r.OnOverrun != nil {
+		r.OnOverrun(snapshot.Tick, took, interval)
+	}
+	if r.OnTick != nil {
+		r.OnTick(snapshot)
+	}
+	return snapshot
+}
+
+func (r *Runner) notify() {
+	select {
+	case r.changed <- struct{}{}:
+	default:
+	}
+}
+
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
+}
@@ -0,0 +1,94 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunnerPauseStepResume(t *testing.T) {
+	g := NewGameWithSeed(8, 8, 4, 21)
+	runner := NewRunner(g, MinTickInterval)
+
+	ticks := make(chan int64, 100)
+	runner.OnTick = func(snapshot GameSnapshot) {
+		select {
+		case ticks <- snapshot.Tick:
+		default:
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runner.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitForTick(t, ticks)
+
+	if _, err := runner.StepOnce(); !errors.Is(err, ErrRunnerNotPaused) {
+		t.Fatalf("expected ErrRunnerNotPaused while running, got %v", err)
+	}
+
+	runner.Pause()
+	// Let a tick that was already in progress finish.
+	time.Sleep(5 * MinTickInterval)
+	drain(ticks)
+
+	paused := g.CurrentTick()
+	time.Sleep(5 * MinTickInterval)
+	if got := g.CurrentTick(); got != paused {
+		t.Fatalf("game ticked while paused: %d -> %d", paused, got)
+	}
+
+	snapshot, err := runner.StepOnce()
+	if err != nil {
+		t.Fatalf("step failed: %v", err)
+	}
+	if snapshot.Tick != paused+1 {
+		t.Fatalf("expected step to reach tick %d, got %d", paused+1, snapshot.Tick)
+	}
+	if got := waitForTick(t, ticks); got != paused+1 {
+		t.Fatalf("expected OnTick for tick %d, got %d", paused+1, got)
+	}
+
+	if err := runner.SetTickInterval(time.Millisecond); !errors.Is(err, ErrInvalidTickInterval) {
+		t.Fatalf("expected ErrInvalidTickInterval, got %v", err)
+	}
+	if err := runner.SetTickInterval(2 * MinTickInterval); err != nil || runner.TickInterval() != 2*MinTickInterval {
+		t.Fatalf("expected the interval to change to %s, got %s (%v)", 2*MinTickInterval, runner.TickInterval(), err)
+	}
+
+	runner.Resume()
+	waitForTick(t, ticks)
+	if stats := runner.Stats(); !stats.Running || stats.Paused {
+		t.Fatalf("expected a running, unpaused runner, got %+v", stats)
+	}
+}
+
+func waitForTick(t *testing.T, ticks <-chan int64) int64 {
+	t.Helper()
+	select {
+	case tick := <-ticks:
+		return tick
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a tick")
+		return 0
+	}
+}
+
+func drain(ticks <-chan int64) {
+	for {
+		select {
+		case <-ticks:
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package game
+
+import (
+	"errors"
+	"math/rand"
+)
+
+// Names of the spread rules a match can be played with.
+const (
+	SpreadMajority       = "majority"
+	SpreadIncumbent      = "incumbent"
+	SpreadRandomTieBreak = "randomTieBreak"
+	SpreadDistance       = "distance"
+	SpreadInfluence      = "influence"
+)
+
+// SpreadRules lists the names accepted in Rules.SpreadRule.
+var SpreadRules = []string{SpreadMajority, SpreadIncumbent, SpreadRandomTieBreak, SpreadDistance, SpreadInfluence}
+
+// IncumbentBonus is how many spread waves the owner's side is credited with
+// under the incumbent rule.
+const IncumbentBonus = 1
+
+var ErrUnknownSpreadRule = errors.New("unknown spread rule")
+
+// SpreadContest is what a SpreadResolver gets to see of one tile on one
+// tick. Core tiles never change hands and are not contested.
+type SpreadContest struct {
+	Position Position
+	// Owner is the current owner, or "" for a neutral tile.
+	Owner string
+	// Spreads is the number of spread waves each player sends into the tile.
+	Spreads map[string]int
+	// Influence is each player's influence on the tile. Resolvers that keep
+	// influence update it in place.
+	Influence map[string]float64
+	// Side returns who a player plays for; players on the same side never
+	// contest each other. Nil puts every player on their own side.
+	Side func(playerID string) string
+	// CoreDistance returns how many tiles the tile is from the player's
+	// nearest core.
+	CoreDistance func(playerID string) int
+	// Rand is the game's spread rng, only drawn from to break ties.
+	Rand *rand.Rand
+}
+
+func (c *SpreadContest) side(playerID string) string {
+	if c.Side == nil {
+		return playerID
+	}
+	return c.Side(playerID)
+}
+
+// SpreadResolver decides who owns a contested tile. Resolve returns the
+// player who takes the tile, or "" when it keeps its owner.
+type SpreadResolver interface {
+	Resolve(c *SpreadContest) string
+}
+
+// NewSpreadResolver returns the resolver for a spread rule; "" is the
+// majority rule.
+func NewSpreadResolver(rules Rules) (SpreadResolver, error) {
+	switch rules.SpreadRule {
+	case "", SpreadMajority:
+		return MajorityResolver{}, nil
+	case SpreadIncumbent:
+		return IncumbentResolver{Bonus: IncumbentBonus}, nil
+	case SpreadRandomTieBreak:
+		return RandomTieBreakResolver{}, nil
+	case SpreadDistance:
+		return DistanceResolver{}, nil
+	case SpreadInfluence:
+		influence := DefaultInfluenceRules
+		if rules.Influence != nil {
+			influence = *rules.Influence
+		}
+		return InfluenceResolver{Rules: influence}, nil
+	default:
+		return nil, ErrUnknownSpreadRule
+	}
+}
+
+// MajorityResolver is the original rule: the side with the most spread waves
+// takes the tile, and a tie for the lead leaves it alone.
+type MajorityResolver struct{}
+
+func (MajorityResolver) Resolve(c *SpreadContest) string {
+	strength := spreadStrength(c)
+	best, _, _ := topSides(c, strength)
+	if len(best) != 1 {
+		return ""
+	}
+	return takeover(c, best[0], strength)
+}
+
+// IncumbentResolver credits the owner's side with Bonus extra waves, so a
+// challenger has to clearly outnumber the owner.
+type IncumbentResolver struct {
+	Bonus int
+}
+
+func (r IncumbentResolver) Resolve(c *SpreadContest) string {
+	strength := spreadStrength(c)
+	totals := sideTotals(c, strength)
+	if c.Owner != "" {
+		totals[c.side(c.Owner)] += float64(r.Bonus)
+	}
+	best, _, _ := rankSides(totals)
+	if len(best) != 1 {
+		return ""
+	}
+	return takeover(c, best[0], strength)
+}
+
+// RandomTieBreakResolver is the majority rule, except that a tie for the
+// lead is decided by the game rng instead of leaving the tile alone.
+type RandomTieBreakResolver struct{}
+
+func (RandomTieBreakResolver) Resolve(c *SpreadContest) string {
+	strength := spreadStrength(c)
+	best, _, _ := topSides(c, strength)
+	switch {
+	case len(best) == 0:
+		return ""
+	case len(best) > 1 && c.Rand != nil:
+		return takeover(c, best[c.Rand.Intn(len(best))], strength)
+	case len(best) > 1:
+		return ""
+	}
+	return takeover(c, best[0], strength)
+}
+
+// DistanceResolver weighs every wave by how close the tile is to its
+// player's nearest core: a wave one tile out counts 1/2, two tiles out 1/3
+// and so on. Ties leave the tile alone.
+type DistanceResolver struct{}
+
+func (DistanceResolver) Resolve(c *SpreadContest) string {
+	strength := func(playerID string) float64 {
+		distance := 0
+		if c.CoreDistance != nil {
+			distance = c.CoreDistance(playerID)
+		}
+		return float64(c.Spreads[playerID]) / float64(1+distance)
+	}
+	best, _, _ := topSides(c, strength)
+	if len(best) != 1 {
+		return ""
+	}
+	return takeover(c, best[0], strength)
+}
+
+// InfluenceResolver adds every wave to its player's influence on the tile
+// and hands the tile to a side whose influence leads every other side's,
+// the owner's included, by more than the margin. The game decays influence
+// between ticks.
+type InfluenceResolver struct {
+	Rules InfluenceRules
+}
+
+func (r InfluenceResolver) Resolve(c *SpreadContest) string {
+	for _, playerID := range sortedKeys(c.Spreads) {
+		if count := c.Spreads[playerID]; count > 0 {
+			if c.Influence == nil {
+				c.Influence = make(map[string]float64)
+			}
+			c.Influence[playerID] = roundInfluence(c.Influence[playerID] + float64(count))
+		}
+	}
+
+	strength := func(playerID string) float64 { return c.Influence[playerID] }
+	totals := make(map[string]float64)
+	for _, playerID := range sortedKeys(c.Influence) {
+		totals[c.side(playerID)] += c.Influence[playerID]
+	}
+	best, top, second := rankSides(totals)
+	if len(best) != 1 || top-second <= r.Rules.Margin {
+		return ""
+	}
+	return takeover(c, best[0], strength)
+}
+
+func spreadStrength(c *SpreadContest) func(string) float64 {
+	return func(playerID string) float64 { return float64(c.Spreads[playerID]) }
+}
+
+func sideTotals(c *SpreadContest, strength func(string) float64) map[string]float64 {
+	totals := make(map[string]float64)
+	for _, playerID := range sortedKeys(c.Spreads) {
+		if v := strength(playerID); v > 0 {
+			totals[c.side(playerID)] += v
+		}
+	}
+	return totals
+}
+
+func topSides(c *SpreadContest, strength func(string) float64) ([]string, float64, float64) {
+	return rankSides(sideTotals(c, strength))
+}
+
+// rankSides returns the sides tied for the lead in name order, the leading
+// total and the best total of the other sides.
+func rankSides(totals map[string]float64) (best []string, top, second float64) {
+	for _, side := range sortedKeys(totals) {
+		switch v := totals[side]; {
+		case v <= 0:
+		case v > top:
+			best, top, second = []string{side}, v, top
+		case v == top:
+			best, second = append(best, side), v
+		case v > second:
+			second = v
+		}
+	}
+	return best, top, second
+}
+
+// takeover returns the player of side with the most strength on the tile,
+// preferring the lowest id on a tie, unless side already owns the tile.
+func takeover(c *SpreadContest, side string, strength func(string) float64) string {
+	if c.Owner != "" && c.side(c.Owner) == side {
+		return ""
+	}
+
+	players := make(map[string]bool)
+	for playerID := range c.Spreads {
+		players[playerID] = true
+	}
+	for playerID := range c.Influence {
+		players[playerID] = true
+	}
+
+	var leader string
+	var leaderStrength float64
+	for _, playerID := range sortedKeys(players) {
+		if v := strength(playerID); v > leaderStrength && c.side(playerID) == side {
+			leader, leaderStrength = playerID, v
+		}
+	}
+	return leader
+}
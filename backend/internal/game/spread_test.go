@@ -0,0 +1,109 @@
+package game
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestSpreadResolvers(t *testing.T) {
+	teams := func(playerID string) string {
+		if playerID == "a2" {
+			return "a"
+		}
+		return playerID
+	}
+	far := func(playerID string) int {
+		if playerID == "b" {
+			return 5
+		}
+		return 0
+	}
+
+	cases := []struct {
+		name     string
+		resolver SpreadResolver
+		contest  SpreadContest
+		want     string
+	}{
+		{"majority takes a neutral tile", MajorityResolver{}, SpreadContest{Spreads: map[string]int{"a": 2, "b": 1}}, "a"},
+		{"majority leaves a tie alone", MajorityResolver{}, SpreadContest{Owner: "c", Spreads: map[string]int{"a": 2, "b": 2}}, ""},
+		{"majority keeps the owner's tile", MajorityResolver{}, SpreadContest{Owner: "a", Spreads: map[string]int{"a": 3, "b": 1}}, ""},
+		{"teammates add up", MajorityResolver{}, SpreadContest{Spreads: map[string]int{"a": 1, "a2": 2, "b": 2}, Side: teams}, "a2"},
+		{"incumbent holds against a narrow lead", IncumbentResolver{Bonus: 1}, SpreadContest{Owner: "a", Spreads: map[string]int{"b": 1}}, ""},
+		{"incumbent falls to a clear lead", IncumbentResolver{Bonus: 1}, SpreadContest{Owner: "a", Spreads: map[string]int{"b": 2}}, "b"},
+		{"random tie-break without a tie", RandomTieBreakResolver{}, SpreadContest{Spreads: map[string]int{"a": 1}}, "a"},
+		{"distance favors the nearer core", DistanceResolver{}, SpreadContest{Spreads: map[string]int{"a": 1, "b": 3}, CoreDistance: far}, "a"},
+		{"influence within the margin", InfluenceResolver{Rules: InfluenceRules{Margin: 2}}, SpreadContest{Spreads: map[string]int{"a": 2}}, ""},
+		{"influence past the margin", InfluenceResolver{Rules: InfluenceRules{Margin: 2}}, SpreadContest{Owner: "b", Spreads: map[string]int{"a": 2}, Influence: map[string]float64{"a": 3, "b": 2}}, "a"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			contest := c.contest
+			if got := c.resolver.Resolve(&contest); got != c.want {
+				t.Fatalf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRandomTieBreakUsesTheRand(t *testing.T) {
+	winners := make(map[string]bool)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		contest := SpreadContest{Spreads: map[string]int{"a": 1, "b": 1}, Rand: rng}
+		winners[RandomTieBreakResolver{}.Resolve(&contest)] = true
+	}
+	if !winners["a"] || !winners["b"] || len(winners) != 2 {
+		t.Fatalf("expected ties to go either way, got %v", winners)
+	}
+
+	contest := SpreadContest{Spreads: map[string]int{"a": 1, "b": 1}}
+	if got := (RandomTieBreakResolver{}).Resolve(&contest); got != "" {
+		t.Fatalf("expected a tie without a rand to be left alone, got %q", got)
+	}
+}
+
+func TestSpreadRuleIsPartOfTheReplay(t *testing.T) {
+	for _, rule := range SpreadRules {
+		g := NewGameWithSeed(12, 12, 6, 9)
+		if err := g.StartRecording(rule); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.SetRules(Rules{SpreadRule: rule}); err != nil {
+			t.Fatal(err)
+		}
+		g.AddPlayer("a")
+		g.AddPlayer("b")
+		g.AddPlayer("c")
+		for i := 0; i < 20; i++ {
+			g.Tick()
+		}
+
+		log, err := g.Recording()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyReplay(log); err != nil {
+			t.Fatalf("%s: %v", rule, err)
+		}
+	}
+
+	if _, err := NewSpreadResolver(Rules{SpreadRule: "loudest"}); !errors.Is(err, ErrUnknownSpreadRule) {
+		t.Fatalf("expected ErrUnknownSpreadRule, got %v", err)
+	}
+}
+
+func TestSetRulesRejectsUnknownSpreadRule(t *testing.T) {
+	g := NewGameWithSeed(12, 12, 6, 9)
+	if err := g.SetRules(Rules{SpreadRule: SpreadDistance}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.SetRules(Rules{SpreadRule: "loudest"}); !errors.Is(err, ErrUnknownSpreadRule) {
+		t.Fatalf("expected ErrUnknownSpreadRule, got %v", err)
+	}
+	if got := g.Rules().SpreadRule; got != SpreadDistance {
+		t.Fatalf("expected the rejected rules to leave %q in place, got %q", SpreadDistance, got)
+	}
+}
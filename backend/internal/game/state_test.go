@@ -0,0 +1,101 @@
+package game
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	g := NewGameWithSeed(10, 10, 8, 11)
+	if _, err := g.AddPlayer("player-1"); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+	if _, err := g.AddPlayer("player-2"); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		g.Tick()
+	}
+
+	var saved bytes.Buffer
+	if err := g.Save(&saved); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	loaded, err := Load(bytes.NewReader(saved.Bytes()))
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if len(loaded.pendingSpreads) == 0 {
+		t.Fatalf("expected in-flight spreads to be restored")
+	}
+
+	var resaved bytes.Buffer
+	if err := loaded.Save(&resaved); err != nil {
+		t.Fatalf("resave failed: %v", err)
+	}
+	if !bytes.Equal(saved.Bytes(), resaved.Bytes()) {
+		t.Fatalf("expected loaded game to save identically")
+	}
+
+	for _, name := range rngStreams {
+		if a, b := g.rand.get(name).Int63(), loaded.rand.get(name).Int63(); a != b {
+			t.Fatalf("expected rng stream %q to continue the same sequence, got %d and %d", name, a, b)
+		}
+	}
+}
+
+func TestLoadRejectsUnknownVersion(t *testing.T) {
+	_, err := Load(strings.NewReader(`{"version":99,"width":1,"height":1}`))
+	if !errors.Is(err, ErrUnsupportedStateVersion) {
+		t.Fatalf("expected ErrUnsupportedStateVersion, got %v", err)
+	}
+}
+
+func TestGamesCreatedWithRandLoadWhereTheyLeftOff(t *testing.T) {
+	g := NewGameWithRand(8, 8, 4, rand.New(rand.NewSource(5)))
+	if _, err := g.AddPlayer("player-1"); err != nil {
+		t.Fatalf("failed to add player: %v", err)
+	}
+	g.Tick()
+
+	var saved bytes.Buffer
+	if err := g.Save(&saved); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	loaded, err := Load(bytes.NewReader(saved.Bytes()))
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		g.Tick()
+		loaded.Tick()
+	}
+	if a, b := g.StateHash(), loaded.StateHash(); a != b {
+		t.Fatalf("expected the loaded game to play out the same, got %s and %s", a, b)
+	}
+}
+
+func TestLoadRejectsStateWithoutRNG(t *testing.T) {
+	var saved bytes.Buffer
+	if err := NewGameWithSeed(4, 4, 0, 1).Save(&saved); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	var state map[string]any
+	if err := json.Unmarshal(saved.Bytes(), &state); err != nil {
+		t.Fatalf("failed to decode state: %v", err)
+	}
+	delete(state, "rngStreams")
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("failed to encode state: %v", err)
+	}
+
+	if _, err := Load(bytes.NewReader(data)); err == nil || !strings.Contains(err.Error(), "rng") {
+		t.Fatalf("expected a state without rng to be rejected, got %v", err)
+	}
+}
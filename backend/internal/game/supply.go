@@ -0,0 +1,49 @@
+package game
+
+// updateSupplyLocked flags every owned tile that is cut off from its side's
+// cores and turns tiles that stayed cut off for the grace period neutral.
+// Tiles connect through the 8 neighbours owned by the same side, the way
+// spreads travel.
+func (g *Game) updateSupplyLocked() {
+	if g.rules.SupplyGraceTicks <= 0 {
+		return
+	}
+
+	connected := make(map[string]bool)
+	queue := make([]Position, 0)
+	for _, id := range g.sortedPlayerIDsLocked() {
+		for _, core := range g.players[id].CorePositions {
+			if key := posKey(core); !connected[key] {
+				connected[key] = true
+				queue = append(queue, core)
+			}
+		}
+	}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		side := g.sideLocked(g.tiles[posKey(current)].OwnerID)
+
+		for _, nb := range g.neighbors(current) {
+			key := posKey(nb)
+			owner := g.tiles[key].OwnerID
+			if connected[key] || owner == "" || g.sideLocked(owner) != side {
+				continue
+			}
+			connected[key] = true
+			queue = append(queue, nb)
+		}
+	}
+
+	for key, tile := range g.tiles {
+		switch {
+		case tile.OwnerID == "" || connected[key]:
+			tile.DisconnectedSince = 0
+		case tile.DisconnectedSince == 0:
+			tile.DisconnectedSince = g.tick
+		case g.tick-tile.DisconnectedSince >= int64(g.rules.SupplyGraceTicks):
+			tile.OwnerID = ""
+			tile.DisconnectedSince = 0
+		}
+	}
+}
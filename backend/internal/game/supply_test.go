@@ -0,0 +1,116 @@
+package game
+
+import "testing"
+
+func TestCutOffTerritoryDecays(t *testing.T) {
+	g := NewGameWithSeed(12, 3, 0, 1)
+	g.SetRules(Rules{SupplyGraceTicks: 3})
+	g.AddPlayerAt("a", Position{X: 0, Y: 1}, "#ff0000")
+
+	island := g.tiles[posKey(Position{X: 8, Y: 1})]
+	island.OwnerID = "a"
+	g.nextResourceID++
+	g.resources["res-1"] = &Resource{ID: "res-1", Position: island.Position}
+	g.resourceByPos[posKey(island.Position)] = "res-1"
+
+	snapshot := g.Tick()
+	if island.DisconnectedSince != 1 {
+		t.Fatalf("expected the island to be flagged on tick 1, got %+v", island)
+	}
+	if next := g.tiles[posKey(Position{X: 1, Y: 1})]; next.OwnerID != "a" || next.DisconnectedSince != 0 {
+		t.Fatalf("expected the tile next to the core to stay supplied, got %+v", next)
+	}
+	for _, tile := range snapshot.Tiles {
+		if tile.Position == island.Position && tile.DisconnectedSince != 1 {
+			t.Fatalf("expected the snapshot to flag the island, got %+v", tile)
+		}
+	}
+
+	g.Tick()
+	g.Tick()
+	if island.OwnerID != "a" || g.resources["res-1"].Position != island.Position {
+		t.Fatalf("expected the island to hold out and its resource to stay put, got %+v", island)
+	}
+	g.Tick()
+	if island.OwnerID != "" || island.DisconnectedSince != 0 {
+		t.Fatalf("expected the island to turn neutral after the grace period, got %+v", island)
+	}
+}
+
+func TestAlliedTerritoryCarriesSupply(t *testing.T) {
+	g := NewGameWithSeed(8, 3, 0, 1)
+	g.SetRules(Rules{SupplyGraceTicks: 5})
+	g.AddPlayerAt("a", Position{X: 0, Y: 1}, "#ff0000")
+	g.AddPlayerAt("b", Position{X: 7, Y: 1}, "#0000ff")
+	for x := 1; x <= 6; x++ {
+		g.tiles[posKey(Position{X: x, Y: 1})].OwnerID = "b"
+	}
+	g.tiles[posKey(Position{X: 1, Y: 1})].OwnerID = "a"
+	g.tiles[posKey(Position{X: 2, Y: 1})].OwnerID = "a"
+	g.tick = 1
+	g.updateSupplyLocked()
+	if since := g.tiles[posKey(Position{X: 2, Y: 1})].DisconnectedSince; since != 0 {
+		t.Fatalf("expected a's tiles next to its core to be supplied, got %d", since)
+	}
+
+	g.tiles[posKey(Position{X: 1, Y: 1})].OwnerID = "b"
+	g.updateSupplyLocked()
+	if since := g.tiles[posKey(Position{X: 2, Y: 1})].DisconnectedSince; since == 0 {
+		t.Fatal("expected a's tile to be cut off by b's territory")
+	}
+
+	g.SetTeam("a", "red")
+	g.SetTeam("b", "red")
+	g.updateSupplyLocked()
+	if since := g.tiles[posKey(Position{X: 2, Y: 1})].DisconnectedSince; since != 0 {
+		t.Fatalf("expected the ally's territory to carry supply, got %d", since)
+	}
+}
+
+func TestSupplyRuleReplays(t *testing.T) {
+	g := NewGameWithSeed(14, 14, 8, 6)
+	if err := g.StartRecording("supply"); err != nil {
+		t.Fatal(err)
+	}
+	g.SetRules(Rules{SupplyGraceTicks: 2})
+	g.AddPlayer("a")
+	g.AddPlayer("b")
+	g.AddPlayer("c")
+	for i := 0; i < 40; i++ {
+		g.Tick()
+	}
+
+	log, err := g.Recording()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyReplay(log); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTurningSupplyOffClearsTheFlags(t *testing.T) {
+	g := NewGameWithSeed(12, 3, 0, 1)
+	g.SetRules(Rules{SupplyGraceTicks: 3})
+	g.AddPlayerAt("a", Position{X: 0, Y: 1}, "#ff0000")
+
+	island := g.tiles[posKey(Position{X: 8, Y: 1})]
+	island.OwnerID = "a"
+	g.Tick()
+	if island.DisconnectedSince == 0 {
+		t.Fatal("expected the island to be flagged")
+	}
+
+	if err := g.SetRules(Rules{}); err != nil {
+		t.Fatal(err)
+	}
+	if island.DisconnectedSince != 0 {
+		t.Fatalf("expected turning the rule off to clear the flag, got %d", island.DisconnectedSince)
+	}
+	for i := 0; i < 5; i++ {
+		g.Tick()
+	}
+	if island.OwnerID != "a" || island.DisconnectedSince != 0 {
+		t.Fatalf("expected the island to be left alone without the rule, got %+v", island)
+	}
+}
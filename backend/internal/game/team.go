@@ -0,0 +1,184 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var ErrTeamsFixed = errors.New("teams are fixed for this match")
+
+// TeamScore is the combined standing of a team's members.
+type TeamScore struct {
+	Members   []string `json:"members"`
+	Tiles     int      `json:"tiles"`
+	Resources int      `json:"resources"`
+}
+
+// Winner is the side that met a win condition. Team is empty when a player
+// without a team won on their own.
+type Winner struct {
+	Team      string   `json:"team,omitempty"`
+	PlayerIDs []string `json:"playerIds"`
+	Reason    string   `json:"reason"`
+	Tick      int64    `json:"tick"`
+}
+
+// SetTeam moves a player to a team; an empty team leaves their team.
+func (g *Game) SetTeam(playerID, team string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	player, ok := g.players[playerID]
+	if !ok {
+		return ErrUnknownPlayer
+	}
+	if g.rules.FixedTeams {
+		return ErrTeamsFixed
+	}
+	if player.Team == team {
+		return nil
+	}
+
+	g.recordLocked(ReplayEvent{Kind: EventTeam, PlayerID: playerID, Team: team})
+	player.Team = team
+	return nil
+}
+
+// FoundTeam puts a player on a new team named name, or name followed by a
+// number when a player is on a team of that name already or the rules assign
+// players to it. An empty name founds a team called "Team". It returns the
+// name the team got.
+func (g *Game) FoundTeam(playerID, name string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	player, ok := g.players[playerID]
+	if !ok {
+		return "", ErrUnknownPlayer
+	}
+	if g.rules.FixedTeams {
+		return "", ErrTeamsFixed
+	}
+
+	if name == "" {
+		name = "Team"
+	}
+	taken := make(map[string]bool)
+	for _, p := range g.players {
+		taken[p.Team] = true
+	}
+	for _, team := range g.rules.Teams {
+		taken[team] = true
+	}
+	team := name
+	for n := 2; taken[team]; n++ {
+		team = fmt.Sprintf("%s %d", name, n)
+	}
+
+	g.recordLocked(ReplayEvent{Kind: EventTeam, PlayerID: playerID, Team: team})
+	player.Team = team
+	return team, nil
+}
+
+// sideLocked is who a player plays for: their team, or themselves when they
+// are not on one. Players on the same side never contest each other.
+func (g *Game) sideLocked(playerID string) string {
+	if player, ok := g.players[playerID]; ok && player.Team != "" {
+		return "team:" + player.Team
+	}
+	return "player:" + playerID
+}
+
+// Allied reports whether two players are on the same side.
+func (g *Game) Allied(a, b string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.sideLocked(a) == g.sideLocked(b)
+}
+
+// teamScoresLocked sums up the tiles and resources of every team.
+func (g *Game) teamScoresLocked() map[string]TeamScore {
+	scores := make(map[string]TeamScore)
+	for _, id := range g.sortedPlayerIDsLocked() {
+		player := g.players[id]
+		if player.Team == "" {
+			continue
+		}
+		score := scores[player.Team]
+		score.Members = append(score.Members, id)
+		score.Resources += player.ResourceCount
+		scores[player.Team] = score
+	}
+	if len(scores) == 0 {
+		return nil
+	}
+	for _, tile := range g.tiles {
+		if tile.OwnerID == "" {
+			continue
+		}
+		if owner, ok := g.players[tile.OwnerID]; ok && owner.Team != "" {
+			score := scores[owner.Team]
+			score.Tiles++
+			scores[owner.Team] = score
+		}
+	}
+	return scores
+}
+
+// checkWinLocked records the first side to meet a win condition. Sides are
+// checked in a fixed order so that a tie is decided the same way every time.
+func (g *Game) checkWinLocked() {
+	if g.winner != nil || (g.rules.WinTerritoryPercent <= 0 && g.rules.WinResources <= 0) {
+		return
+	}
+
+	tiles := make(map[string]int)
+	for _, tile := range g.tiles {
+		if tile.OwnerID != "" {
+			tiles[g.sideLocked(tile.OwnerID)]++
+		}
+	}
+	resources := make(map[string]int)
+	members := make(map[string][]string)
+	for _, id := range g.sortedPlayerIDsLocked() {
+		side := g.sideLocked(id)
+		resources[side] += g.players[id].ResourceCount
+		members[side] = append(members[side], id)
+	}
+
+	sides := make([]string, 0, len(members))
+	for side := range members {
+		sides = append(sides, side)
+	}
+	sort.Strings(sides)
+
+	board := g.width * g.height
+	for _, side := range sides {
+		reason := ""
+		switch {
+		case g.rules.WinTerritoryPercent > 0 && tiles[side]*100 >= g.rules.WinTerritoryPercent*board:
+			reason = "territory"
+		case g.rules.WinResources > 0 && resources[side] >= g.rules.WinResources:
+			reason = "resources"
+		default:
+			continue
+		}
+		g.winner = &Winner{
+			Team:      g.players[members[side][0]].Team,
+			PlayerIDs: members[side],
+			Reason:    reason,
+			Tick:      g.tick,
+		}
+		return
+	}
+}
+
+func cloneWinner(w *Winner) *Winner {
+	if w == nil {
+		return nil
+	}
+	copy := *w
+	copy.PlayerIDs = append([]string(nil), w.PlayerIDs...)
+	return &copy
+}
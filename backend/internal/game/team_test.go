@@ -0,0 +1,99 @@
+package game
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTeammatesDoNotContestEachOther(t *testing.T) {
+	for _, team := range []bool{false, true} {
+		g := NewGameWithSeed(8, 8, 0, 1)
+		if _, err := g.AddPlayerAt("a", Position{X: 2, Y: 3}, "#ff0000"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := g.AddPlayerAt("b", Position{X: 4, Y: 3}, "#0000ff"); err != nil {
+			t.Fatal(err)
+		}
+		if team {
+			g.SetTeam("a", "red")
+			g.SetTeam("b", "red")
+		}
+		g.Tick()
+
+		owner := g.tiles[posKey(Position{X: 3, Y: 3})].OwnerID
+		switch {
+		case !team && owner != "":
+			t.Fatalf("rivals should contest the tile between them, got %q", owner)
+		case team && owner != "a":
+			t.Fatalf("teammates should share the tile between them, got %q", owner)
+		}
+	}
+}
+
+func TestAlliedResourcesRouteToNearestAlliedCore(t *testing.T) {
+	g := NewGameWithSeed(12, 3, 0, 1)
+	g.AddPlayerAt("a", Position{X: 0, Y: 1}, "#ff0000")
+	g.AddPlayerAt("b", Position{X: 11, Y: 1}, "#0000ff")
+	g.SetTeam("a", "red")
+	g.SetTeam("b", "red")
+
+	distances := g.buildDistanceMapsLocked()[g.sideLocked("a")]
+	if d := distances[posKey(Position{X: 9, Y: 1})]; d != 2 {
+		t.Fatalf("expected the ally's core to be 2 tiles away, got %d", d)
+	}
+}
+
+func TestFoundTeamPicksAFreeName(t *testing.T) {
+	g := NewGameWithSeed(10, 10, 0, 4)
+	g.SetRules(Rules{Teams: map[string]string{"z": "Ada 2"}})
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := g.AddPlayer(id); err != nil {
+			t.Fatalf("failed to add player: %v", err)
+		}
+	}
+
+	for _, c := range []struct{ playerID, name, want string }{{"a", "Ada", "Ada"}, {"b", "Ada", "Ada 3"}, {"c", "", "Team"}} {
+		team, err := g.FoundTeam(c.playerID, c.name)
+		if err != nil || team != c.want {
+			t.Fatalf("expected %s to found %q, got %q (%v)", c.playerID, c.want, team, err)
+		}
+	}
+	if g.Allied("a", "b") {
+		t.Fatal("expected teams with the same base name to stay apart")
+	}
+}
+
+func TestRulesAssignTeamsAndDecideTheWinner(t *testing.T) {
+	g := NewGameWithSeed(10, 10, 0, 4)
+	if err := g.StartRecording("teams"); err != nil {
+		t.Fatal(err)
+	}
+	g.SetRules(Rules{Teams: map[string]string{"a": "red", "b": "red"}, FixedTeams: true, WinTerritoryPercent: 20})
+
+	g.AddPlayerAt("a", Position{X: 1, Y: 1}, "")
+	g.AddPlayerAt("b", Position{X: 3, Y: 1}, "")
+	g.AddPlayerAt("c", Position{X: 8, Y: 8}, "")
+	if err := g.SetTeam("c", "red"); !errors.Is(err, ErrTeamsFixed) {
+		t.Fatalf("expected ErrTeamsFixed, got %v", err)
+	}
+
+	var snapshot GameSnapshot
+	for i := 0; i < 10 && snapshot.Winner == nil; i++ {
+		snapshot = g.Tick()
+	}
+	if snapshot.Winner == nil || snapshot.Winner.Team != "red" || snapshot.Winner.Reason != "territory" {
+		t.Fatalf("expected red to win by territory, got %+v", snapshot.Winner)
+	}
+	red := snapshot.Teams["red"]
+	if len(red.Members) != 2 || red.Tiles*100 < 20*100 {
+		t.Fatalf("unexpected team score %+v", red)
+	}
+
+	log, err := g.Recording()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyReplay(log); err != nil {
+		t.Fatal(err)
+	}
+}
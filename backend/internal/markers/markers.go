@@ -0,0 +1,298 @@
+// Package markers keeps map pings, which are short lived and shared with a
+// player's allies, and personal markers, which are stored until removed.
+package markers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/game"
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/storage"
+)
+
+type PingKind string
+
+const (
+	PingAttack   PingKind = "attack"
+	PingDefend   PingKind = "defend"
+	PingResource PingKind = "resource"
+)
+
+const MaxLabelLength = 32
+
+var (
+	ErrUnknownKind   = errors.New("unknown ping kind")
+	ErrRateLimited   = errors.New("you are pinging too often")
+	ErrTooMany       = errors.New("you have too many markers")
+	ErrLabelTooLong  = errors.New("marker label is too long")
+	ErrUnknownMarker = errors.New("unknown marker")
+)
+
+// Config limits pings and markers.
+type Config struct {
+	// PingTTL is how long a ping stays on the map.
+	PingTTL time.Duration
+	// PingLimit pings may be sent per PingWindow.
+	PingLimit  int
+	PingWindow time.Duration
+	// MaxMarkers is how many markers a player may keep.
+	MaxMarkers int
+}
+
+var DefaultConfig = Config{
+	PingTTL:    8 * time.Second,
+	PingLimit:  3,
+	PingWindow: 10 * time.Second,
+	MaxMarkers: 20,
+}
+
+// Ping is a timed signal at a position. Team is the sender's team when they
+// sent it.
+type Ping struct {
+	ID        string        `json:"id"`
+	PlayerID  string        `json:"playerId"`
+	Team      string        `json:"team,omitempty"`
+	Kind      PingKind      `json:"kind"`
+	Position  game.Position `json:"position"`
+	CreatedAt time.Time     `json:"createdAt"`
+	ExpiresAt time.Time     `json:"expiresAt"`
+}
+
+// Marker is a note a player left on the map for themselves.
+type Marker struct {
+	ID        string        `json:"id"`
+	PlayerID  string        `json:"playerId"`
+	Position  game.Position `json:"position"`
+	Label     string        `json:"label,omitempty"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+// TeamOf returns the team of a player, or "" when they are not on one.
+type TeamOf func(playerID string) string
+
+// Board keeps the active pings in memory and writes markers through to the
+// store, one entry per player.
+type Board struct {
+	mu      sync.Mutex
+	config  Config
+	store   storage.Store
+	teamOf  TeamOf
+	pings   []Ping
+	sent    map[string][]time.Time
+	markers map[string][]Marker
+	nextID  int64
+	now     func() time.Time
+}
+
+// Load reads the stored markers. teamOf may be nil while there are no teams,
+// in which case pings are only shown to their sender.
+func Load(ctx context.Context, store storage.Store, config Config, teamOf TeamOf) (*Board, error) {
+	ids, err := store.List(ctx, storage.CollectionMarkers)
+	if err != nil {
+		return nil, err
+	}
+	if teamOf == nil {
+		teamOf = func(string) string { return "" }
+	}
+
+	b := &Board{
+		config:  config,
+		store:   store,
+		teamOf:  teamOf,
+		sent:    make(map[string][]time.Time),
+		markers: make(map[string][]Marker, len(ids)),
+		now:     time.Now,
+	}
+	for _, id := range ids {
+		var markers []Marker
+		if err := storage.GetJSON(ctx, store, storage.CollectionMarkers, id, &markers); err != nil {
+			return nil, err
+		}
+		b.markers[id] = markers
+		// Marker ids stay unique across restarts.
+		for _, m := range markers {
+			if n, err := strconv.ParseInt(strings.TrimPrefix(m.ID, "m"), 10, 64); err == nil && n > b.nextID {
+				b.nextID = n
+			}
+		}
+	}
+	return b, nil
+}
+
+// Ping places a ping for the sender and their allies.
+func (b *Board) Ping(playerID string, kind PingKind, pos game.Position) (Ping, error) {
+	switch kind {
+	case PingAttack, PingDefend, PingResource:
+	default:
+		return Ping{}, ErrUnknownKind
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if !b.allowLocked(playerID, now) {
+		return Ping{}, ErrRateLimited
+	}
+	b.pruneLocked(now)
+
+	b.nextID++
+	ping := Ping{
+		ID:        "p" + strconv.FormatInt(b.nextID, 10),
+		PlayerID:  playerID,
+		Team:      b.teamOf(playerID),
+		Kind:      kind,
+		Position:  pos,
+		CreatedAt: now.UTC(),
+		ExpiresAt: now.Add(b.config.PingTTL).UTC(),
+	}
+	b.pings = append(b.pings, ping)
+	return ping, nil
+}
+
+// allowLocked enforces the ping limit over a sliding window.
+func (b *Board) allowLocked(playerID string, now time.Time) bool {
+	recent := b.sent[playerID][:0]
+	for _, at := range b.sent[playerID] {
+		if now.Sub(at) < b.config.PingWindow {
+			recent = append(recent, at)
+		}
+	}
+	if len(recent) >= b.config.PingLimit {
+		b.sent[playerID] = recent
+		return false
+	}
+	b.sent[playerID] = append(recent, now)
+	return true
+}
+
+// pruneLocked drops expired pings and the rate limit windows of players who
+// have not pinged for a whole window.
+func (b *Board) pruneLocked(now time.Time) {
+	active := b.pings[:0]
+	for _, ping := range b.pings {
+		if now.Before(ping.ExpiresAt) {
+			active = append(active, ping)
+		}
+	}
+	b.pings = active
+
+	for playerID, times := range b.sent {
+		if len(times) == 0 || now.Sub(times[len(times)-1]) >= b.config.PingWindow {
+			delete(b.sent, playerID)
+		}
+	}
+}
+
+// VisibleTo reports whether playerID sees the ping: its sender does, and so
+// does everyone on the team the sender was on.
+func (b *Board) VisibleTo(ping Ping, playerID string) bool {
+	if ping.PlayerID == playerID {
+		return true
+	}
+	return ping.Team != "" && b.teamOf(playerID) == ping.Team
+}
+
+// Pings returns the unexpired pings playerID sees.
+func (b *Board) Pings(playerID string) []Ping {
+	b.mu.Lock()
+	b.pruneLocked(b.now())
+	pings := append([]Ping(nil), b.pings...)
+	b.mu.Unlock()
+
+	visible := make([]Ping, 0, len(pings))
+	for _, ping := range pings {
+		if b.VisibleTo(ping, playerID) {
+			visible = append(visible, ping)
+		}
+	}
+	return visible
+}
+
+// AddMarker stores a marker for playerID.
+func (b *Board) AddMarker(ctx context.Context, playerID string, pos game.Position, label string) (Marker, error) {
+	label = strings.TrimSpace(label)
+	if utf8.RuneCountInString(label) > MaxLabelLength {
+		return Marker{}, ErrLabelTooLong
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	markers := b.markers[playerID]
+	if len(markers) >= b.config.MaxMarkers {
+		return Marker{}, ErrTooMany
+	}
+
+	b.nextID++
+	marker := Marker{
+		ID:        "m" + strconv.FormatInt(b.nextID, 10),
+		PlayerID:  playerID,
+		Position:  pos,
+		Label:     label,
+		CreatedAt: b.now().UTC(),
+	}
+	updated := append(append([]Marker(nil), markers...), marker)
+	if err := b.saveLocked(ctx, playerID, updated); err != nil {
+		return Marker{}, err
+	}
+	return marker, nil
+}
+
+// RemoveMarker deletes one of playerID's markers.
+func (b *Board) RemoveMarker(ctx context.Context, playerID, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	markers := b.markers[playerID]
+	for i, m := range markers {
+		if m.ID == id {
+			updated := append(append([]Marker(nil), markers[:i]...), markers[i+1:]...)
+			return b.saveLocked(ctx, playerID, updated)
+		}
+	}
+	return ErrUnknownMarker
+}
+
+// Markers returns playerID's markers in the order they were placed.
+func (b *Board) Markers(playerID string) []Marker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Marker(nil), b.markers[playerID]...)
+}
+
+// Clear drops every ping and marker, which no longer make sense once the
+// board they were placed on is gone.
+func (b *Board) Clear(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pings = nil
+	for playerID := range b.markers {
+		if err := b.store.Delete(ctx, storage.CollectionMarkers, playerID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		delete(b.markers, playerID)
+	}
+	return nil
+}
+
+func (b *Board) saveLocked(ctx context.Context, playerID string, markers []Marker) error {
+	if len(markers) == 0 {
+		if err := b.store.Delete(ctx, storage.CollectionMarkers, playerID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		delete(b.markers, playerID)
+		return nil
+	}
+	if err := storage.PutJSON(ctx, b.store, storage.CollectionMarkers, playerID, markers); err != nil {
+		return err
+	}
+	b.markers[playerID] = markers
+	return nil
+}
@@ -0,0 +1,100 @@
+package markers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/game"
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/storage"
+)
+
+func TestPingsExpireAndReachAllies(t *testing.T) {
+	teams := map[string]string{"a": "red", "b": "red", "c": "blue"}
+	b, err := Load(context.Background(), storage.NewMemoryStore(), Config{PingTTL: 5 * time.Second, PingLimit: 2, PingWindow: 10 * time.Second, MaxMarkers: 1}, func(id string) string {
+		return teams[id]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	if _, err := b.Ping("a", "dance", game.Position{}); !errors.Is(err, ErrUnknownKind) {
+		t.Fatalf("expected ErrUnknownKind, got %v", err)
+	}
+	ping, err := b.Ping("a", PingAttack, game.Position{X: 3, Y: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]bool{"a": true, "b": true, "c": false} {
+		if got := b.VisibleTo(ping, id); got != want {
+			t.Errorf("VisibleTo(%s) = %v, want %v", id, got, want)
+		}
+	}
+
+	if _, err := b.Ping("a", PingDefend, game.Position{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Ping("a", PingDefend, game.Position{}); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+
+	now = now.Add(5 * time.Second)
+	if pings := b.Pings("b"); len(pings) != 0 {
+		t.Fatalf("pings should have expired, got %+v", pings)
+	}
+
+	now = now.Add(5 * time.Second)
+	b.Pings("b")
+	if len(b.sent) != 0 {
+		t.Fatalf("expected rate limit windows to be dropped once they passed, got %v", b.sent)
+	}
+}
+
+func TestMarkersArePersisted(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	b, err := Load(ctx, store, DefaultConfig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := b.AddMarker(ctx, "a", game.Position{X: 1, Y: 2}, "  gold  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Label != "gold" {
+		t.Fatalf("label should be trimmed, got %q", first.Label)
+	}
+	second, err := b.AddMarker(ctx, "a", game.Position{X: 5, Y: 5}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.AddMarker(ctx, "a", game.Position{}, "this label is far too long to keep around"); !errors.Is(err, ErrLabelTooLong) {
+		t.Fatalf("expected ErrLabelTooLong, got %v", err)
+	}
+	if err := b.RemoveMarker(ctx, "a", first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.RemoveMarker(ctx, "b", second.ID); !errors.Is(err, ErrUnknownMarker) {
+		t.Fatalf("players may only remove their own markers, got %v", err)
+	}
+
+	reloaded, err := Load(ctx, store, DefaultConfig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	markers := reloaded.Markers("a")
+	if len(markers) != 1 || markers[0].ID != second.ID || markers[0].Position != second.Position {
+		t.Fatalf("unexpected markers after reload: %+v", markers)
+	}
+	third, err := reloaded.AddMarker(ctx, "a", game.Position{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.ID == second.ID {
+		t.Fatal("marker ids must stay unique across restarts")
+	}
+}
@@ -0,0 +1,73 @@
+package profile
+
+import (
+	"strings"
+	"unicode"
+)
+
+// defaultBlockedWords are rejected anywhere in a name.
+var defaultBlockedWords = []string{
+	"fuck", "shit", "cunt", "bitch", "bastard", "whore", "slut", "wanker",
+	"asshole", "dickhead", "motherf", "penis", "vagina", "porn", "nazi", "hitler",
+}
+
+// defaultBlockedTokens are short words that are only rejected on their own,
+// so that names like "Classic" or "Dickens" stay allowed.
+var defaultBlockedTokens = []string{
+	"ass", "arse", "cock", "dick", "fag", "tit", "tits", "cum", "sex", "kkk",
+}
+
+// reservedNames could be mistaken for staff or the server itself.
+var reservedNames = []string{
+	"admin", "administrator", "moderator", "mod", "system", "server", "staff",
+}
+
+// leet undoes common character substitutions before matching.
+var leet = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b", "@", "a", "$", "s", "!", "i",
+)
+
+// Filter rejects offensive and reserved display names.
+type Filter struct {
+	words  []string
+	tokens map[string]bool
+}
+
+// NewFilter builds the default filter extended by extraWords, which are
+// matched anywhere in a name.
+func NewFilter(extraWords ...string) *Filter {
+	f := &Filter{tokens: make(map[string]bool)}
+	for _, word := range append(defaultBlockedWords, extraWords...) {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			f.words = append(f.words, word)
+		}
+	}
+	for _, token := range append(defaultBlockedTokens, reservedNames...) {
+		f.tokens[token] = true
+	}
+	return f
+}
+
+// Blocked reports whether name contains a blocked word, is a blocked word
+// on its own, or is a reserved name.
+func (f *Filter) Blocked(name string) bool {
+	lowered := leet.Replace(strings.ToLower(name))
+
+	tokens := strings.FieldsFunc(lowered, func(r rune) bool { return !unicode.IsLetter(r) })
+	joined := strings.Join(tokens, "")
+	if f.tokens[joined] {
+		return true
+	}
+	for _, token := range tokens {
+		if f.tokens[token] {
+			return true
+		}
+	}
+	// Separators are dropped so that "f.u.c.k" is caught as well.
+	for _, word := range f.words {
+		if strings.Contains(joined, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package profile
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/storage"
+)
+
+const (
+	MinNameLength = 3
+	MaxNameLength = 24
+)
+
+var (
+	ErrNameLength   = errors.New("display name must be between 3 and 24 characters")
+	ErrNameInvalid  = errors.New("display name may only contain letters, digits, spaces and _ - .")
+	ErrNameBlocked  = errors.New("display name is not allowed")
+	ErrNameTaken    = errors.New("display name is already taken")
+	ErrInvalidColor = errors.New("color must look like #rrggbb")
+)
+
+// Profile is what a player chose to show to others, plus the contact details
+// from their token. Only the display name and color are public.
+type Profile struct {
+	PlayerID    string    `json:"playerId"`
+	DisplayName string    `json:"displayName,omitempty"`
+	Color       string    `json:"color,omitempty"`
+	Email       string    `json:"email,omitempty"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Claims are the profile related claims of a token.
+type Claims struct {
+	PreferredUsername string
+	Email             string
+}
+
+// Update changes the fields that are set. An empty display name or color
+// clears it.
+type Update struct {
+	DisplayName *string `json:"displayName"`
+	Color       *string `json:"color"`
+}
+
+// Registry keeps every profile in memory to enforce unique names and writes
+// changes through to the store.
+type Registry struct {
+	mu       sync.RWMutex
+	store    storage.Store
+	filter   *Filter
+	profiles map[string]Profile
+	// names maps folded display names to the player holding them.
+	names map[string]string
+}
+
+// Load reads all stored profiles.
+func Load(ctx context.Context, store storage.Store, filter *Filter) (*Registry, error) {
+	ids, err := store.List(ctx, storage.CollectionProfiles)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Registry{
+		store:    store,
+		filter:   filter,
+		profiles: make(map[string]Profile, len(ids)),
+		names:    make(map[string]string, len(ids)),
+	}
+	for _, id := range ids {
+		var p Profile
+		if err := storage.GetJSON(ctx, store, storage.CollectionProfiles, id, &p); err != nil {
+			return nil, err
+		}
+		r.profiles[id] = p
+		if p.DisplayName != "" {
+			r.names[foldName(p.DisplayName)] = id
+		}
+	}
+	return r, nil
+}
+
+func (r *Registry) Get(playerID string) (Profile, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, ok := r.profiles[playerID]
+	return p, ok
+}
+
+// Ensure returns the player's profile, creating it on first sight. A new
+// profile takes preferred_username as display name when it is valid and
+// free. The email follows the token.
+func (r *Registry) Ensure(ctx context.Context, playerID string, claims Claims) (Profile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.profiles[playerID]
+	if ok && p.Email == claims.Email {
+		return p, nil
+	}
+	if !ok {
+		p = Profile{PlayerID: playerID}
+		if name, err := r.checkNameLocked(playerID, claims.PreferredUsername); err == nil {
+			p.DisplayName = name
+		}
+	}
+	p.Email = claims.Email
+	p.UpdatedAt = time.Now().UTC()
+
+	if err := r.saveLocked(ctx, p); err != nil {
+		return Profile{}, err
+	}
+	return p, nil
+}
+
+// Update validates and applies a change to the player's profile.
+func (r *Registry) Update(ctx context.Context, playerID string, update Update) (Profile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.profiles[playerID]
+	if !ok {
+		p = Profile{PlayerID: playerID}
+	}
+	if update.DisplayName != nil {
+		name := ""
+		if strings.TrimSpace(*update.DisplayName) != "" {
+			var err error
+			if name, err = r.checkNameLocked(playerID, *update.DisplayName); err != nil {
+				return Profile{}, err
+			}
+		}
+		p.DisplayName = name
+	}
+	if update.Color != nil {
+		color := ""
+		if *update.Color != "" {
+			var err error
+			if color, err = NormalizeColor(*update.Color); err != nil {
+				return Profile{}, err
+			}
+		}
+		p.Color = color
+	}
+	p.UpdatedAt = time.Now().UTC()
+
+	if err := r.saveLocked(ctx, p); err != nil {
+		return Profile{}, err
+	}
+	return p, nil
+}
+
+func (r *Registry) saveLocked(ctx context.Context, p Profile) error {
+	if err := storage.PutJSON(ctx, r.store, storage.CollectionProfiles, p.PlayerID, p); err != nil {
+		return err
+	}
+	if old, ok := r.profiles[p.PlayerID]; ok && old.DisplayName != "" {
+		delete(r.names, foldName(old.DisplayName))
+	}
+	if p.DisplayName != "" {
+		r.names[foldName(p.DisplayName)] = p.PlayerID
+	}
+	r.profiles[p.PlayerID] = p
+	return nil
+}
+
+// checkNameLocked returns the cleaned up name if playerID may use it.
+func (r *Registry) checkNameLocked(playerID, name string) (string, error) {
+	name, err := ValidateName(name)
+	if err != nil {
+		return "", err
+	}
+	if r.filter.Blocked(name) {
+		return "", ErrNameBlocked
+	}
+	if holder, ok := r.names[foldName(name)]; ok && holder != playerID {
+		return "", ErrNameTaken
+	}
+	return name, nil
+}
+
+// ValidateName collapses whitespace and checks length and characters.
+func ValidateName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if n := utf8.RuneCountInString(name); n < MinNameLength || n > MaxNameLength {
+		return "", ErrNameLength
+	}
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(" _-.", r) {
+			continue
+		}
+		return "", ErrNameInvalid
+	}
+	return name, nil
+}
+
+// foldName is the form names are compared in, so that names differing only
+// in case cannot be told apart by other players.
+func foldName(name string) string {
+	return strings.ToLower(name)
+}
+
+// NormalizeColor accepts #rrggbb in any case and returns it in lower case.
+func NormalizeColor(color string) (string, error) {
+	color = strings.ToLower(strings.TrimSpace(color))
+	if len(color) != 7 || color[0] != '#' {
+		return "", ErrInvalidColor
+	}
+	for _, c := range color[1:] {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return "", ErrInvalidColor
+		}
+	}
+	return color, nil
+}
@@ -0,0 +1,104 @@
+package profile
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/johnlacomba/game-spheres-of-influence/backend/internal/storage"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestValidateName(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{"  Alice   Smith ", "Alice Smith", nil},
+		{"Zoë_99", "Zoë_99", nil},
+		{"ab", "", ErrNameLength},
+		{"a-very-long-name-that-keeps-going", "", ErrNameLength},
+		{"<script>", "", ErrNameInvalid},
+	}
+	for _, tc := range cases {
+		got, err := ValidateName(tc.in)
+		if !errors.Is(err, tc.err) || got != tc.want {
+			t.Errorf("ValidateName(%q) = %q, %v; want %q, %v", tc.in, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f := NewFilter("badword")
+	for _, name := range []string{"Fuck_you", "sh1t happens", "f.u.c.k", "Admin", "mod", "big ass", "my badword"} {
+		if !f.Blocked(name) {
+			t.Errorf("expected %q to be blocked", name)
+		}
+	}
+	for _, name := range []string{"Classic", "Dickens", "Cassandra", "Modest Mouse", "Alice"} {
+		if f.Blocked(name) {
+			t.Errorf("expected %q to be allowed", name)
+		}
+	}
+}
+
+func TestRegistryNamesAreUniqueAndPersisted(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	r, err := Load(ctx, store, NewFilter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := r.Ensure(ctx, "sub-a", Claims{PreferredUsername: "alice", Email: "a@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.DisplayName != "alice" || alice.Email != "a@example.com" {
+		t.Fatalf("expected the token claims to seed the profile, got %+v", alice)
+	}
+
+	// The preferred username is taken, so the second player starts unnamed.
+	bob, err := r.Ensure(ctx, "sub-b", Claims{PreferredUsername: "ALICE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.DisplayName != "" {
+		t.Fatalf("expected no display name, got %q", bob.DisplayName)
+	}
+
+	if _, err := r.Update(ctx, "sub-b", Update{DisplayName: strPtr("Alice")}); !errors.Is(err, ErrNameTaken) {
+		t.Fatalf("expected ErrNameTaken, got %v", err)
+	}
+	if _, err := r.Update(ctx, "sub-b", Update{Color: strPtr("red")}); !errors.Is(err, ErrInvalidColor) {
+		t.Fatalf("expected ErrInvalidColor, got %v", err)
+	}
+	bob, err = r.Update(ctx, "sub-b", Update{DisplayName: strPtr("Bob"), Color: strPtr("#A0B1C2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.DisplayName != "Bob" || bob.Color != "#a0b1c2" {
+		t.Fatalf("unexpected profile %+v", bob)
+	}
+
+	// Renaming frees the old name.
+	if _, err := r.Update(ctx, "sub-a", Update{DisplayName: strPtr("Alicia")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Update(ctx, "sub-b", Update{DisplayName: strPtr("alice")}); err != nil {
+		t.Fatalf("expected the released name to be free: %v", err)
+	}
+
+	reloaded, err := Load(ctx, store, NewFilter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := reloaded.Get("sub-b"); !ok || p.DisplayName != "alice" || p.Color != "#a0b1c2" {
+		t.Fatalf("profile not persisted: %+v", p)
+	}
+	if _, err := reloaded.Update(ctx, "sub-a", Update{DisplayName: strPtr("Alice")}); !errors.Is(err, ErrNameTaken) {
+		t.Fatalf("expected the reloaded registry to know taken names, got %v", err)
+	}
+}
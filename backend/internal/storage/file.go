@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const fileSuffix = ".dat"
+
+// FileStore keeps each value in its own file below dir, one directory per
+// collection. Writes go to a temporary file that is renamed into place so a
+// crash never leaves a partially written value behind.
+type FileStore struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		return nil, errors.New("storage: directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (f *FileStore) Get(_ context.Context, collection, key string) ([]byte, error) {
+	if err := validate(collection, key); err != nil {
+		return nil, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	data, err := os.ReadFile(f.path(collection, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (f *FileStore) Put(_ context.Context, collection, key string, value []byte) error {
+	if err := validate(collection, key); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dir := f.collectionDir(collection)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path(collection, key))
+}
+
+func (f *FileStore) Delete(_ context.Context, collection, key string) error {
+	if err := validate(collection, key); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := os.Remove(f.path(collection, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (f *FileStore) List(_ context.Context, collection string) ([]string, error) {
+	if err := validateCollection(collection); err != nil {
+		return nil, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	entries, err := os.ReadDir(f.collectionDir(collection))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		key, err := url.PathUnescape(strings.TrimSuffix(name, fileSuffix))
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (f *FileStore) Close() error {
+	return nil
+}
+
+func (f *FileStore) collectionDir(collection string) string {
+	return filepath.Join(f.dir, url.PathEscape(collection))
+}
+
+// path escapes the key so that arbitrary keys (including ones containing
+// path separators) map to a single file inside the collection directory.
+func (f *FileStore) path(collection, key string) string {
+	return filepath.Join(f.collectionDir(collection), url.PathEscape(key)+fileSuffix)
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps everything in memory. It is meant for tests and for
+// deployments that do not need data to survive a restart.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	collections map[string]map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		collections: make(map[string]map[string][]byte),
+	}
+}
+
+func (m *MemoryStore) Get(_ context.Context, collection, key string) ([]byte, error) {
+	if err := validate(collection, key); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	value, ok := m.collections[collection][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+func (m *MemoryStore) Put(_ context.Context, collection, key string, value []byte) error {
+	if err := validate(collection, key); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	items, ok := m.collections[collection]
+	if !ok {
+		items = make(map[string][]byte)
+		m.collections[collection] = items
+	}
+	items[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *MemoryStore) Delete(_ context.Context, collection, key string) error {
+	if err := validate(collection, key); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.collections[collection][key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.collections[collection], key)
+	return nil
+}
+
+func (m *MemoryStore) List(_ context.Context, collection string) ([]string, error) {
+	if err := validateCollection(collection); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]string, 0, len(m.collections[collection]))
+	for key := range m.collections[collection] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
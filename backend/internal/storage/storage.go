@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+var ErrNotFound = errors.New("storage: not found")
+
+// Collections used by the server for durable data.
+const (
+	CollectionProfiles       = "profiles"
+	CollectionMatches        = "matches"
+	CollectionCheckpoints    = "checkpoints"
+	CollectionLeaderboards   = "leaderboards"
+	CollectionBans           = "bans"
+	CollectionSettings       = "settings"
+	CollectionMarkers        = "markers"
+	CollectionMatchSummaries = "matchSummaries"
+)
+
+// Store persists opaque values grouped into named collections. Keys are
+// unique within a collection. Implementations must be safe for concurrent
+// use.
+type Store interface {
+	Get(ctx context.Context, collection, key string) ([]byte, error)
+	Put(ctx context.Context, collection, key string, value []byte) error
+	Delete(ctx context.Context, collection, key string) error
+	// List returns the keys of a collection in ascending order.
+	List(ctx context.Context, collection string) ([]string, error)
+	Close() error
+}
+
+func GetJSON(ctx context.Context, s Store, collection, key string, out interface{}) error {
+	data, err := s.Get(ctx, collection, key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func PutJSON(ctx context.Context, s Store, collection, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, collection, key, data)
+}
+
+func validate(collection, key string) error {
+	if err := validateCollection(collection); err != nil {
+		return err
+	}
+	if key == "" {
+		return errors.New("storage: key is required")
+	}
+	return nil
+}
+
+func validateCollection(collection string) error {
+	if collection == "" || collection == "." || collection == ".." {
+		return errors.New("storage: invalid collection name")
+	}
+	return nil
+}
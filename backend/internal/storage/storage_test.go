@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStores(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create file store: %v", err)
+	}
+
+	stores := map[string]Store{
+		"memory": NewMemoryStore(),
+		"file":   fileStore,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, store)
+		})
+	}
+}
+
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, CollectionProfiles, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := s.Put(ctx, CollectionProfiles, "b/2", []byte("two")); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if err := PutJSON(ctx, s, CollectionProfiles, "a", map[string]int{"score": 1}); err != nil {
+		t.Fatalf("put json failed: %v", err)
+	}
+
+	value, err := s.Get(ctx, CollectionProfiles, "b/2")
+	if err != nil || string(value) != "two" {
+		t.Fatalf("expected stored value, got %q (%v)", value, err)
+	}
+
+	var decoded map[string]int
+	if err := GetJSON(ctx, s, CollectionProfiles, "a", &decoded); err != nil || decoded["score"] != 1 {
+		t.Fatalf("expected decoded json, got %v (%v)", decoded, err)
+	}
+
+	keys, err := s.List(ctx, CollectionProfiles)
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a", "b/2"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	if keys, err := s.List(ctx, CollectionMatches); err != nil || len(keys) != 0 {
+		t.Fatalf("expected empty collection, got %v (%v)", keys, err)
+	}
+
+	if err := s.Delete(ctx, CollectionProfiles, "a"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := s.Delete(ctx, CollectionProfiles, "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound on second delete, got %v", err)
+	}
+
+	if err := s.Put(ctx, "..", "escape", nil); err == nil {
+		t.Fatalf("expected invalid collection to be rejected")
+	}
+}
@@ -5,13 +5,19 @@ import { useEffect, useState } from 'react';
 import { GameBoard } from './components/GameBoard';
 import { useGameConnection } from './hooks/useGameConnection';
 import { getConfig } from './config';
-import type { GameSnapshot, Player } from './types';
+import type { ChatMessage, GameSnapshot, Player } from './types';
 
 interface SessionInfo {
   token?: string;
   username?: string;
 }
 
+// Amplify refreshes the session when its tokens have expired.
+async function refreshIdToken(): Promise<string> {
+  const authSession = await Auth.currentSession();
+  return authSession.getIdToken().getJwtToken();
+}
+
 function GameView({ signOut }: { signOut?: () => void }) {
   const [session, setSession] = useState<SessionInfo>({});
   const [loadingSession, setLoadingSession] = useState(false);
@@ -47,7 +53,22 @@ function GameView({ signOut }: { signOut?: () => void }) {
     };
   }, []);
 
-  const { snapshot, player, connecting, error } = useGameConnection(session.token);
+  const {
+    snapshot,
+    player,
+    connecting,
+    error,
+    notice,
+    chat,
+    muted,
+    pings,
+    markers,
+    allianceRequests,
+    agreementProposals,
+    actionError,
+    send,
+    sendChat,
+  } = useGameConnection(session.token, refreshIdToken);
   const debugMode = !session.token && !!config.debugPlayerId;
 
   return (
@@ -57,7 +78,7 @@ function GameView({ signOut }: { signOut?: () => void }) {
           <div>
             <h2>Players</h2>
             <p>Tick: {snapshot?.tick ?? '--'}</p>
-            {player ? <p>Logged in as {player.id}</p> : null}
+            {player ? <p>Logged in as {player.displayName ?? player.id}</p> : null}
             {session.username ? <p>Cognito user: {session.username}</p> : null}
             {debugMode ? <p>Developer player: {config.debugPlayerId}</p> : null}
           </div>
@@ -68,20 +89,60 @@ function GameView({ signOut }: { signOut?: () => void }) {
           ) : null}
         </div>
 
-        <PlayersPanel players={snapshot?.players} me={player} />
+        <PlayersPanel
+          players={snapshot?.players}
+          me={player}
+          onInvite={(id) => send({ type: 'allianceRequest', playerId: id })}
+          onOfferTruce={(id) => send({ type: 'proposeAgreement', playerId: id, kind: 'truce' })}
+        />
+
+        <RequestsPanel
+          requests={allianceRequests
+            .filter((request) => request.to === player?.id)
+            .map((request) => ({
+              key: `alliance:${request.from}`,
+              label: `${playerName(snapshot?.players, request.from)} invites you to their team`,
+              accept: () => send({ type: 'allianceAccept', playerId: request.from }),
+              decline: () => send({ type: 'allianceDecline', playerId: request.from }),
+            }))
+            .concat(
+              agreementProposals
+                .filter((proposal) => proposal.to === player?.id)
+                .map((proposal) => ({
+                  key: `agreement:${proposal.from}:${proposal.kind}`,
+                  label: `${playerName(snapshot?.players, proposal.from)} offers a ${proposal.kind} for ${proposal.ticks} ticks`,
+                  accept: () => send({ type: 'acceptAgreement', playerId: proposal.from, kind: proposal.kind }),
+                  decline: () => send({ type: 'declineAgreement', playerId: proposal.from, kind: proposal.kind }),
+                }))
+            )}
+        />
+
+        <ChatPanel messages={chat} muted={muted?.reason} onSend={sendChat} />
+        {actionError ? <div className="error-banner">{actionError}</div> : null}
 
+        {notice ? <div className="connection-status">{notice.message}</div> : null}
         {error ? <div className="error-banner">{error}</div> : null}
         {connecting ? <div className="connection-status">Connecting...</div> : null}
       </aside>
 
       <section className="game-board-wrapper">
-        {snapshot ? <GameBoard snapshot={snapshot} /> : <div className="connection-status">Waiting for game data…</div>}
+        {snapshot ? <GameBoard snapshot={snapshot} pings={pings} markers={markers} /> : <div className="connection-status">Waiting for game data…</div>}
       </section>
     </div>
   );
 }
 
-function PlayersPanel({ players, me }: { players?: Record<string, Player>; me: Player | null }) {
+function PlayersPanel({
+  players,
+  me,
+  onInvite,
+  onOfferTruce,
+}: {
+  players?: Record<string, Player>;
+  me: Player | null;
+  onInvite: (playerId: string) => void;
+  onOfferTruce: (playerId: string) => void;
+}) {
   if (!players || Object.keys(players).length === 0) {
     return <p>No players connected yet.</p>;
   }
@@ -96,11 +157,22 @@ function PlayersPanel({ players, me }: { players?: Record<string, Player>; me: P
           <div key={player.id} className="player-card">
             <strong>
               <span className="player-swatch" style={{ backgroundColor: player.color }} />
-              {player.id} {isMe ? '(You)' : ''}
+              {player.displayName ?? player.id} {isMe ? '(You)' : ''}
             </strong>
             <span>Resources: {player.resourceCount}</span>
             <span>Cores: {player.corePositions.length}</span>
             <span>Joined at tick {player.joinedAtTick}</span>
+            {player.team ? <span>Team: {player.team}</span> : null}
+            {!isMe && (!player.team || player.team !== me?.team) ? (
+              <button type="button" onClick={() => onInvite(player.id)}>
+                Invite to team
+              </button>
+            ) : null}
+            {!isMe ? (
+              <button type="button" onClick={() => onOfferTruce(player.id)}>
+                Offer truce
+              </button>
+            ) : null}
           </div>
         );
       })}
@@ -108,6 +180,84 @@ function PlayersPanel({ players, me }: { players?: Record<string, Player>; me: P
   );
 }
 
+function playerName(players: Record<string, Player> | undefined, id: string) {
+  return players?.[id]?.displayName ?? id;
+}
+
+interface PendingRequest {
+  key: string;
+  label: string;
+  accept: () => void;
+  decline: () => void;
+}
+
+function RequestsPanel({ requests }: { requests: PendingRequest[] }) {
+  if (requests.length === 0) {
+    return null;
+  }
+
+  return (
+    <div className="players-grid">
+      {requests.map((request) => (
+        <div key={request.key} className="player-card">
+          <span>{request.label}</span>
+          <div className="chat-form">
+            <button type="button" onClick={request.accept}>
+              Accept
+            </button>
+            <button type="button" onClick={request.decline}>
+              Decline
+            </button>
+          </div>
+        </div>
+      ))}
+    </div>
+  );
+}
+
+function ChatPanel({
+  messages,
+  muted,
+  onSend,
+}: {
+  messages: ChatMessage[];
+  muted?: string;
+  onSend: (text: string) => boolean;
+}) {
+  const [draft, setDraft] = useState('');
+
+  return (
+    <div className="chat-panel">
+      <h2>Chat</h2>
+      <div className="chat-log">
+        {messages.map((message) => (
+          <p key={message.id}>
+            <strong>{message.fromName ?? message.from}</strong>
+            {message.channel !== 'global' ? ` (${message.channel})` : ''}:{' '}
+            {message.deleted ? <em>message removed</em> : message.text}
+          </p>
+        ))}
+      </div>
+      <form
+        className="chat-form"
+        onSubmit={(event) => {
+          event.preventDefault();
+          if (draft.trim() && onSend(draft)) {
+            setDraft('');
+          }
+        }}
+      >
+        <input
+          value={draft}
+          onChange={(event) => setDraft(event.target.value)}
+          placeholder={muted ? `Muted: ${muted}` : 'Say something'}
+        />
+        <button type="submit">Send</button>
+      </form>
+    </div>
+  );
+}
+
 function AuthenticatedApp() {
   return (
     <Authenticator>
@@ -132,7 +282,7 @@ export default function App() {
       <div className="app-shell">
         <header>
           <h1>Game: Spheres of Influence</h1>
-          <p>Developer mode (Cognito disabled). Provide VITE_DEBUG_PLAYER_ID to simulate a player.</p>
+          <p>Developer mode (Cognito disabled). Provide VITE_DEBUG_PLAYER_ID to sign in through the backend dev issuer.</p>
         </header>
         <GameView />
       </div>
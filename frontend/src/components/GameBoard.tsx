@@ -1,10 +1,12 @@
 import { useMemo } from 'react';
 import type { CSSProperties, ReactNode } from 'react';
-import type { GameSnapshot, Player, Tile } from '../types';
+import type { GameSnapshot, MapMarker, MapPing, Player, Position, Tile } from '../types';
 import './GameBoard.css';
 
 interface GameBoardProps {
   snapshot: GameSnapshot;
+  pings?: MapPing[];
+  markers?: MapMarker[];
 }
 
 type TileMap = Map<string, Tile>;
@@ -17,6 +19,14 @@ function buildTileMap(tiles: Tile[]): TileMap {
   return map;
 }
 
+function byPosition<T extends { position: Position }>(items: T[] | undefined): Map<string, T> {
+  const map = new Map<string, T>();
+  for (const item of items ?? []) {
+    map.set(`${item.position.x}:${item.position.y}`, item);
+  }
+  return map;
+}
+
 function getTileOwnerColor(tile: Tile | undefined, players: Record<string, Player>): string {
   if (tile?.ownerId && players[tile.ownerId]) {
     return players[tile.ownerId].color;
@@ -27,8 +37,14 @@ function getTileOwnerColor(tile: Tile | undefined, players: Record<string, Playe
   return '#0f172a';
 }
 
-export function GameBoard({ snapshot }: GameBoardProps) {
+export function GameBoard({ snapshot, pings, markers }: GameBoardProps) {
   const tileMap = useMemo(() => buildTileMap(snapshot.tiles), [snapshot.tiles]);
+  // Pings expire on their own; the next tick's snapshot drops them.
+  const pingMap = useMemo(
+    () => byPosition(pings?.filter((ping) => Date.parse(ping.expiresAt) > Date.now())),
+    [pings, snapshot.tick]
+  );
+  const markerMap = useMemo(() => byPosition(markers), [markers]);
   const { width, height, players } = snapshot;
 
   const cells = useMemo(() => {
@@ -45,6 +61,14 @@ export function GameBoard({ snapshot }: GameBoardProps) {
         if (tile?.resourceBase) {
           classes.push('tile-resource-base');
         }
+        const ping = pingMap.get(key);
+        const marker = markerMap.get(key);
+        if (ping) {
+          classes.push('tile-ping');
+        }
+        if (marker) {
+          classes.push('tile-marker');
+        }
 
         rendered.push(
           <div
@@ -52,6 +76,7 @@ export function GameBoard({ snapshot }: GameBoardProps) {
             className={classes.join(' ')}
             style={{ backgroundColor: ownerColor }}
             data-coords={`${x},${y}`}
+            title={ping ? `${ping.kind} ping` : marker?.label}
           >
             {tile?.hasResource ? <span className="resource-pill" /> : null}
           </div>
@@ -59,7 +84,7 @@ export function GameBoard({ snapshot }: GameBoardProps) {
       }
     }
     return rendered;
-  }, [height, width, tileMap, players]);
+  }, [height, width, tileMap, players, pingMap, markerMap]);
 
   const gridStyle: CSSProperties = useMemo(
     () => ({
@@ -44,6 +44,7 @@ export interface AppConfig {
   cognitoUserPoolId?: string;
   cognitoAppClientId?: string;
   debugPlayerId?: string;
+  debugGroups?: string;
 }
 
 let cachedConfig: AppConfig | null = null;
@@ -58,7 +59,8 @@ export function getConfig(): AppConfig {
     VITE_COGNITO_REGION,
     VITE_COGNITO_USER_POOL_ID,
     VITE_COGNITO_APP_CLIENT_ID,
-    VITE_DEBUG_PLAYER_ID
+    VITE_DEBUG_PLAYER_ID,
+    VITE_DEBUG_GROUPS
   } = import.meta.env;
 
   cachedConfig = {
@@ -66,25 +68,49 @@ export function getConfig(): AppConfig {
     cognitoRegion: VITE_COGNITO_REGION as string | undefined,
     cognitoUserPoolId: VITE_COGNITO_USER_POOL_ID as string | undefined,
     cognitoAppClientId: VITE_COGNITO_APP_CLIENT_ID as string | undefined,
-    debugPlayerId: VITE_DEBUG_PLAYER_ID as string | undefined
+    debugPlayerId: VITE_DEBUG_PLAYER_ID as string | undefined,
+    debugGroups: VITE_DEBUG_GROUPS as string | undefined
   };
 
   return cachedConfig;
 }
 
-export function buildWebSocketUrl(token?: string, debugPlayerId?: string): string {
+// The token is sent in an auth message once the socket is open, so that it
+// does not end up in proxy access logs. A resume token only works together
+// with the player's own token and can go in the query.
+export function buildWebSocketUrl(resume?: { token: string; lastTick?: number }): string {
   const { backendBaseUrl } = getConfig();
   const url = new URL(backendBaseUrl);
   url.pathname = '/ws';
   url.search = '';
   url.hash = '';
   url.protocol = url.protocol === 'https:' ? 'wss:' : 'ws:';
-
-  if (token) {
-    url.searchParams.set('token', token);
-  } else if (debugPlayerId) {
-    url.searchParams.set('playerId', debugPlayerId);
+  if (resume) {
+    url.searchParams.set('resume', resume.token);
+    if (resume.lastTick !== undefined) {
+      url.searchParams.set('lastTick', String(resume.lastTick));
+    }
   }
 
   return url.toString();
 }
+
+// fetchDevToken mints a token from the backend's development issuer
+// (AUTH_DEV_ISSUER=true) for the given player id.
+export async function fetchDevToken(subject: string, groups?: string): Promise<string> {
+  const { backendBaseUrl } = getConfig();
+  const url = new URL('/dev/token', backendBaseUrl);
+  url.searchParams.set('sub', subject);
+  if (groups) {
+    url.searchParams.set('groups', groups);
+  }
+
+  const response = await fetch(url.toString());
+  if (!response.ok) {
+    const text = await response.text();
+    throw new Error(text || `Dev token request failed with status ${response.status}`);
+  }
+
+  const body = (await response.json()) as { token: string };
+  return body.token;
+}
@@ -0,0 +1,34 @@
+import type { GameSnapshot, SnapshotDelta } from './types';
+
+// applyDelta mirrors SnapshotDelta.Apply on the backend: it returns a new
+// snapshot with the delta applied on top of base.
+export function applyDelta(base: GameSnapshot, delta: SnapshotDelta): GameSnapshot {
+  const players = { ...base.players };
+  for (const id of delta.removedPlayers ?? []) {
+    delete players[id];
+  }
+  Object.assign(players, delta.players ?? {});
+
+  const tiles = [...base.tiles];
+  const index = new Map(tiles.map((tile, i) => [`${tile.position.x}:${tile.position.y}`, i]));
+  for (const tile of delta.tiles ?? []) {
+    const i = index.get(`${tile.position.x}:${tile.position.y}`);
+    if (i === undefined) {
+      tiles.push(tile);
+    } else {
+      tiles[i] = tile;
+    }
+  }
+
+  return {
+    tick: delta.tick,
+    width: base.width,
+    height: base.height,
+    players,
+    tiles,
+    resources: [...delta.resources],
+    teams: delta.teams,
+    winner: delta.winner,
+    agreements: delta.agreements,
+  };
+}
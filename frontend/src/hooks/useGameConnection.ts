@@ -1,38 +1,196 @@
 import { useCallback, useEffect, useMemo, useRef, useState } from 'react';
-import { buildWebSocketUrl, getConfig } from '../config';
-import type { GameSnapshot, Player } from '../types';
+import { buildWebSocketUrl, fetchDevToken, getConfig } from '../config';
+import { applyDelta } from '../delta';
+import type {
+  Agreement,
+  AgreementProposal,
+  AllianceRequest,
+  ChatChannel,
+  ChatMessage,
+  GameSnapshot,
+  MapMarker,
+  MapPing,
+  Player,
+  SnapshotDelta,
+} from '../types';
+
+// Notice is a server message meant to be shown to the player as is.
+export interface Notice {
+  type: 'announcement' | 'kicked' | 'restarting' | 'agreementBroken';
+  message: string;
+}
+
+// Mute is set while a moderator has muted the player.
+export interface Mute {
+  until: string;
+  reason: string;
+}
 
 interface GameConnectionState {
   snapshot: GameSnapshot | null;
   player: Player | null;
   connecting: boolean;
   error?: string;
+  notice?: Notice;
+  chat: ChatMessage[];
+  muted?: Mute;
+  pings: MapPing[];
+  markers: MapMarker[];
+  // allianceRequests are the pending requests the player sent or received.
+  allianceRequests: AllianceRequest[];
+  // agreementProposals are the pending proposals the player sent or received.
+  // Agreements in force are part of the snapshot.
+  agreementProposals: AgreementProposal[];
+  // actionError is the reason the server gave for rejecting the player's
+  // last chat message or other action.
+  actionError?: string;
 }
 
 const initialState: GameConnectionState = {
   snapshot: null,
   player: null,
   connecting: false,
+  chat: [],
+  pings: [],
+  markers: [],
+  allianceRequests: [],
+  agreementProposals: [],
 };
 
+// The server replays at most CHAT_HISTORY_SIZE messages, 100 by default.
+const CHAT_LIMIT = 100;
+
 type IncomingMessage =
   | {
       type: 'welcome';
       player: Player;
       snapshot: GameSnapshot;
+      resumeToken: string;
+      chatHistory?: ChatMessage[];
+      pings?: MapPing[];
+      markers?: MapMarker[];
+    }
+  | {
+      type: 'resume';
+      player: Player;
+      deltas?: SnapshotDelta[];
+      resumeToken: string;
+      chatHistory?: ChatMessage[];
+      pings?: MapPing[];
+      markers?: MapMarker[];
     }
   | {
       type: 'snapshot';
       snapshot: GameSnapshot;
+    }
+  | {
+      // Sent by replay streams after a seek, which may go back in time.
+      type: 'replaySeek';
+      snapshot: GameSnapshot;
+    }
+  | {
+      // Sent when an admin starts a new match: the player rejoins with new
+      // cores and possibly a new color.
+      type: 'reset';
+      player: Player;
+      snapshot: GameSnapshot;
+    }
+  | {
+      // restarting comes right before the server closes the socket with
+      // 1012; the hook reconnects once it is back.
+      type: 'announcement' | 'kicked' | 'restarting';
+      message: string;
+    }
+  | {
+      // chatDeleted carries the message with its text removed.
+      type: 'chat' | 'chatDeleted';
+      chat: ChatMessage;
+    }
+  | {
+      type: 'muted';
+      message: string;
+      expiresAt: string;
+    }
+  | {
+      type: 'ping';
+      ping: MapPing;
+    }
+  | {
+      // markerRemoved only carries the marker's id and owner.
+      type: 'marker' | 'markerRemoved';
+      marker: MapMarker;
+    }
+  | {
+      type: 'allianceRequest' | 'allianceAccepted' | 'allianceDeclined';
+      alliance: AllianceRequest;
+    }
+  | {
+      type: 'agreementProposed' | 'agreementDeclined';
+      proposal: AgreementProposal;
+    }
+  | {
+      type: 'agreementAccepted' | 'agreementBroken';
+      agreement: Agreement;
+    }
+  | {
+      type: 'chatError' | 'pingError' | 'markerError' | 'allianceError' | 'agreementError';
+      message: string;
+    }
+  | {
+      type: 'tokenExpiring' | 'reauthOk';
+      expiresAt: string;
+    }
+  | {
+      type: 'reauthFailed';
+      message: string;
     };
 
+// Sent by the server when the token expired without a successful reauth.
+const TOKEN_EXPIRED_CLOSE_CODE = 4001;
+// Sent by the server when the auth message was missing or invalid.
+const AUTH_FAILED_CLOSE_CODE = 4002;
+// Sent by the server when a banned player connects.
+const POLICY_VIOLATION_CLOSE_CODE = 1008;
+
+const RECONNECT_BASE_DELAY_MS = 1000;
+const RECONNECT_MAX_DELAY_MS = 15000;
+
+const handledTypes = new Set([
+  'welcome',
+  'resume',
+  'snapshot',
+  'replaySeek',
+  'reset',
+  'tokenExpiring',
+  'reauthOk',
+  'reauthFailed',
+  'announcement',
+  'kicked',
+  'restarting',
+  'chat',
+  'chatDeleted',
+  'muted',
+  'chatError',
+  'ping',
+  'marker',
+  'markerRemoved',
+  'pingError',
+  'markerError',
+  'allianceRequest',
+  'allianceAccepted',
+  'allianceDeclined',
+  'allianceError',
+  'agreementProposed',
+  'agreementAccepted',
+  'agreementDeclined',
+  'agreementBroken',
+  'agreementError',
+]);
+
 function parseMessage(payload: string): IncomingMessage | null {
   try {
     const data = JSON.parse(payload);
-    if ((data as IncomingMessage).type === 'welcome') {
-      return data as IncomingMessage;
-    }
-    if ((data as IncomingMessage).type === 'snapshot') {
+    if (handledTypes.has((data as IncomingMessage).type)) {
       return data as IncomingMessage;
     }
   } catch (error) {
@@ -41,12 +199,27 @@ function parseMessage(payload: string): IncomingMessage | null {
   return null;
 }
 
-export function useGameConnection(token?: string) {
-  const { backendBaseUrl, debugPlayerId } = useConfigMemo();
+function sameProposal(a: AgreementProposal, b: AgreementProposal) {
+  return a.from === b.from && a.to === b.to && a.kind === b.kind;
+}
+
+// refreshToken returns a fresh token when the server warns that the current
+// one is about to expire. Without it the current token is sent again.
+export function useGameConnection(token?: string, refreshToken?: () => Promise<string>) {
+  const { backendBaseUrl, debugPlayerId, debugGroups } = useConfigMemo();
   const [state, setState] = useState<GameConnectionState>(initialState);
   const wsRef = useRef<WebSocket | null>(null);
   const tokenRef = useRef<string | undefined>(token);
   const debugPlayerRef = useRef<string | undefined>(debugPlayerId);
+  const refreshTokenRef = useRef(refreshToken);
+  // The resume token and the last snapshot outlive a single socket, so that a
+  // reconnect only has to catch up on the ticks it missed.
+  const resumeTokenRef = useRef<string | undefined>(undefined);
+  const snapshotRef = useRef<GameSnapshot | null>(null);
+
+  useEffect(() => {
+    refreshTokenRef.current = refreshToken;
+  }, [refreshToken]);
 
   useEffect(() => {
     tokenRef.current = token;
@@ -56,16 +229,20 @@ export function useGameConnection(token?: string) {
     debugPlayerRef.current = debugPlayerId;
   }, [debugPlayerId]);
 
-  const registerPlayer = useCallback(async () => {
-    const currentToken = tokenRef.current;
-    const debugPlayer = debugPlayerRef.current;
-
-    const headers: Record<string, string> = { 'Content-Type': 'application/json' };
-    if (currentToken) {
-      headers.Authorization = `Bearer ${currentToken}`;
-    } else if (debugPlayer) {
-      headers['X-Debug-Player'] = debugPlayer;
+  const resolveToken = useCallback(async () => {
+    if (tokenRef.current) {
+      return refreshTokenRef.current ? refreshTokenRef.current() : tokenRef.current;
     }
+    // Without Cognito the backend's dev issuer signs a token for the debug
+    // player, which is then validated like any other token.
+    return fetchDevToken(debugPlayerRef.current as string, debugGroups);
+  }, [debugGroups]);
+
+  const registerPlayer = useCallback(async (currentToken: string) => {
+    const headers: Record<string, string> = {
+      'Content-Type': 'application/json',
+      Authorization: `Bearer ${currentToken}`,
+    };
 
   const playerUrl = new URL('/api/player', backendBaseUrl);
   const response = await fetch(playerUrl.toString(), {
@@ -85,6 +262,19 @@ export function useGameConnection(token?: string) {
   useEffect(() => {
     let isMounted = true;
     let socket: WebSocket | null = null;
+    let reconnectTimer: ReturnType<typeof setTimeout> | undefined;
+    let attempts = 0;
+
+    function setSnapshot(snapshot: GameSnapshot) {
+      snapshotRef.current = snapshot;
+      setState((prev: GameConnectionState) => ({ ...prev, snapshot }));
+    }
+
+    function scheduleReconnect() {
+      const delay = Math.min(RECONNECT_BASE_DELAY_MS * 2 ** attempts, RECONNECT_MAX_DELAY_MS);
+      attempts++;
+      reconnectTimer = setTimeout(connect, delay);
+    }
 
     async function connect() {
       if (!tokenRef.current && !debugPlayerRef.current) {
@@ -92,21 +282,29 @@ export function useGameConnection(token?: string) {
         return;
       }
 
-  setState({ snapshot: null, player: null, connecting: true, error: undefined });
+  setState((prev: GameConnectionState) => ({ ...prev, connecting: true, error: undefined }));
 
       try {
-        const player = await registerPlayer();
+        const currentToken = await resolveToken();
+        if (!isMounted) {
+          return;
+        }
+
+        const player = await registerPlayer(currentToken);
         if (!isMounted) {
           return;
         }
 
   setState((prev: GameConnectionState) => ({ ...prev, player }));
 
-        const wsUrl = buildWebSocketUrl(tokenRef.current, debugPlayerRef.current);
-        socket = new WebSocket(wsUrl);
-        wsRef.current = socket;
+        const resumeToken = resumeTokenRef.current;
+        const wsUrl = buildWebSocketUrl(resumeToken ? { token: resumeToken, lastTick: snapshotRef.current?.tick } : undefined);
+        const current = new WebSocket(wsUrl);
+        socket = current;
+        wsRef.current = current;
 
         socket.onopen = () => {
+          current.send(JSON.stringify({ type: 'auth', token: currentToken }));
           if (!isMounted) {
             return;
           }
@@ -123,12 +321,205 @@ export function useGameConnection(token?: string) {
           }
 
           if (message.type === 'welcome') {
-            setState({ snapshot: message.snapshot, player: message.player, connecting: false });
+            attempts = 0;
+            resumeTokenRef.current = message.resumeToken;
+            snapshotRef.current = message.snapshot;
+            setState((prev: GameConnectionState) => ({
+              ...prev,
+              snapshot: message.snapshot,
+              player: message.player,
+              chat: message.chatHistory ?? [],
+              pings: message.pings ?? [],
+              markers: message.markers ?? [],
+              connecting: false,
+              error: undefined,
+              notice: prev.notice?.type === 'restarting' ? undefined : prev.notice,
+            }));
+            return;
+          }
+
+          if (message.type === 'resume') {
+            attempts = 0;
+            resumeTokenRef.current = message.resumeToken;
+            let snapshot = snapshotRef.current;
+            for (const delta of message.deltas ?? []) {
+              if (snapshot && delta.tick > snapshot.tick) {
+                snapshot = applyDelta(snapshot, delta);
+              }
+            }
+            snapshotRef.current = snapshot;
+            setState((prev: GameConnectionState) => ({
+              ...prev,
+              snapshot,
+              player: message.player,
+              chat: message.chatHistory ?? [],
+              pings: message.pings ?? [],
+              markers: message.markers ?? [],
+              connecting: false,
+              error: undefined,
+              notice: prev.notice?.type === 'restarting' ? undefined : prev.notice,
+            }));
             return;
           }
 
           if (message.type === 'snapshot') {
-            setState((prev: GameConnectionState) => ({ ...prev, snapshot: message.snapshot }));
+            const latest = snapshotRef.current;
+            if (!latest || message.snapshot.tick > latest.tick) {
+              setSnapshot(message.snapshot);
+            }
+            return;
+          }
+
+          if (message.type === 'replaySeek') {
+            setSnapshot(message.snapshot);
+            return;
+          }
+
+          if (message.type === 'reset') {
+            // The tick counter keeps counting across matches, but the new
+            // board replaces the old one whatever its tick.
+            snapshotRef.current = message.snapshot;
+            // Markers are cleared when a new match starts.
+            setState((prev: GameConnectionState) => ({
+              ...prev,
+              snapshot: message.snapshot,
+              player: message.player,
+              pings: [],
+              markers: [],
+              allianceRequests: [],
+              agreementProposals: [],
+            }));
+            return;
+          }
+
+          if (message.type === 'announcement' || message.type === 'kicked' || message.type === 'restarting') {
+            setState((prev: GameConnectionState) => ({ ...prev, notice: { type: message.type, message: message.message } }));
+            return;
+          }
+
+          if (message.type === 'chat') {
+            const chat = message.chat;
+            setState((prev: GameConnectionState) => ({ ...prev, chat: [...prev.chat, chat].slice(-CHAT_LIMIT) }));
+            return;
+          }
+
+          if (message.type === 'chatDeleted') {
+            const deleted = message.chat;
+            setState((prev: GameConnectionState) => ({
+              ...prev,
+              chat: prev.chat.map((entry) => (entry.id === deleted.id ? deleted : entry)),
+            }));
+            return;
+          }
+
+          if (message.type === 'muted') {
+            setState((prev: GameConnectionState) => ({
+              ...prev,
+              muted: { until: message.expiresAt, reason: message.message },
+            }));
+            return;
+          }
+
+          if (message.type === 'ping') {
+            const ping = message.ping;
+            setState((prev: GameConnectionState) => {
+              const now = Date.now();
+              const active = prev.pings.filter((entry) => Date.parse(entry.expiresAt) > now);
+              return { ...prev, pings: [...active, ping] };
+            });
+            return;
+          }
+
+          if (message.type === 'marker') {
+            const marker = message.marker;
+            setState((prev: GameConnectionState) => ({
+              ...prev,
+              markers: [...prev.markers.filter((entry) => entry.id !== marker.id), marker],
+            }));
+            return;
+          }
+
+          if (message.type === 'markerRemoved') {
+            const removed = message.marker;
+            setState((prev: GameConnectionState) => ({
+              ...prev,
+              markers: prev.markers.filter((entry) => entry.id !== removed.id),
+            }));
+            return;
+          }
+
+          if (
+            message.type === 'allianceRequest' ||
+            message.type === 'allianceAccepted' ||
+            message.type === 'allianceDeclined'
+          ) {
+            // An answered request is gone; team changes arrive with the next
+            // snapshot.
+            const request = message.alliance;
+            const pending = message.type === 'allianceRequest';
+            setState((prev: GameConnectionState) => ({
+              ...prev,
+              allianceRequests: [
+                ...prev.allianceRequests.filter((entry) => entry.from !== request.from || entry.to !== request.to),
+                ...(pending ? [request] : []),
+              ],
+            }));
+            return;
+          }
+
+          if (message.type === 'agreementProposed' || message.type === 'agreementDeclined') {
+            const proposal = message.proposal;
+            const pending = message.type === 'agreementProposed';
+            setState((prev: GameConnectionState) => ({
+              ...prev,
+              agreementProposals: [
+                ...prev.agreementProposals.filter((entry) => !sameProposal(entry, proposal)),
+                ...(pending ? [proposal] : []),
+              ],
+            }));
+            return;
+          }
+
+          if (message.type === 'agreementAccepted') {
+            const { kind, players } = message.agreement;
+            setState((prev: GameConnectionState) => ({
+              ...prev,
+              agreementProposals: prev.agreementProposals.filter(
+                (entry) => entry.kind !== kind || !players.includes(entry.from) || !players.includes(entry.to)
+              ),
+            }));
+            return;
+          }
+
+          if (message.type === 'agreementBroken') {
+            const { kind, brokenBy } = message.agreement;
+            setState((prev: GameConnectionState) => ({
+              ...prev,
+              notice: { type: 'agreementBroken', message: `${brokenBy ?? 'A player'} broke the ${kind} agreement` },
+            }));
+            return;
+          }
+
+          if (
+            message.type === 'chatError' ||
+            message.type === 'pingError' ||
+            message.type === 'markerError' ||
+            message.type === 'allianceError' ||
+            message.type === 'agreementError'
+          ) {
+            setState((prev: GameConnectionState) => ({ ...prev, actionError: message.message }));
+            return;
+          }
+
+          if (message.type === 'tokenExpiring') {
+            resolveToken()
+              .then((fresh) => current.send(JSON.stringify({ type: 'reauth', token: fresh })))
+              .catch((error) => console.error('Failed to refresh token', error));
+            return;
+          }
+
+          if (message.type === 'reauthFailed') {
+            console.warn('Reauthentication failed', message.message);
           }
         };
 
@@ -140,11 +531,23 @@ export function useGameConnection(token?: string) {
           setState((prev: GameConnectionState) => ({ ...prev, error: 'Connection error', connecting: false }));
         };
 
-        socket.onclose = () => {
-          if (!isMounted) {
+        socket.onclose = (event) => {
+          // A socket closed through disconnect is no longer wsRef.current.
+          if (!isMounted || wsRef.current !== current) {
             return;
           }
-          setState((prev: GameConnectionState) => ({ ...prev, connecting: false }));
+          let error: string | undefined;
+          if (event.code === TOKEN_EXPIRED_CLOSE_CODE) {
+            error = 'Session expired, please sign in again';
+          } else if (event.code === AUTH_FAILED_CLOSE_CODE) {
+            error = `Authentication failed: ${event.reason}`;
+          } else if (event.code === POLICY_VIOLATION_CLOSE_CODE) {
+            error = event.reason || 'Connection refused';
+          }
+          setState((prev: GameConnectionState) => ({ ...prev, connecting: false, error: error ?? prev.error }));
+          if (!error) {
+            scheduleReconnect();
+          }
         };
       } catch (error) {
         console.error('Failed to connect', error);
@@ -152,6 +555,10 @@ export function useGameConnection(token?: string) {
           return;
         }
   setState((prev: GameConnectionState) => ({ ...prev, error: (error as Error).message, connecting: false }));
+        // The first attempt reports its error; reconnects keep trying.
+        if (attempts > 0) {
+          scheduleReconnect();
+        }
       }
     }
 
@@ -159,11 +566,29 @@ export function useGameConnection(token?: string) {
 
     return () => {
       isMounted = false;
+      clearTimeout(reconnectTimer);
       if (socket) {
         socket.close();
       }
     };
-  }, [registerPlayer, token]);
+  }, [registerPlayer, resolveToken, token]);
+
+  // send writes a player action, such as a chat message, to the open socket.
+  // It reports false when there is no connection to send it on.
+  const send = useCallback((message: { type: string } & Record<string, unknown>) => {
+    const socket = wsRef.current;
+    if (!socket || socket.readyState !== WebSocket.OPEN) {
+      return false;
+    }
+    setState((prev: GameConnectionState) => ({ ...prev, actionError: undefined }));
+    socket.send(JSON.stringify(message));
+    return true;
+  }, []);
+
+  const sendChat = useCallback(
+    (text: string, channel: ChatChannel = 'global', to?: string) => send({ type: 'chat', channel, text, to }),
+    [send],
+  );
 
   const disconnect = useCallback(() => {
     if (wsRef.current) {
@@ -174,6 +599,8 @@ export function useGameConnection(token?: string) {
 
   return {
     ...state,
+    send,
+    sendChat,
     disconnect,
   };
 }
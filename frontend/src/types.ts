@@ -12,10 +12,14 @@ export interface Tile {
   hasResource: boolean;
   coreBorder: boolean;
   resourceBase: boolean;
+  influence?: Record<string, number>;
+  disconnectedSince?: number;
 }
 
 export interface Player {
   id: string;
+  displayName?: string;
+  team?: string;
   color: string;
   corePositions: Position[];
   resourceCount: number;
@@ -35,4 +39,96 @@ export interface GameSnapshot {
   players: Record<string, Player>;
   tiles: Tile[];
   resources: Resource[];
+  teams?: Record<string, TeamScore>;
+  winner?: Winner;
+  agreements?: Agreement[];
+}
+
+export interface Agreement {
+  id: string;
+  kind: 'truce' | 'nonAggression';
+  players: [string, string];
+  startTick: number;
+  endTick: number;
+  penalty: number;
+  brokenBy?: string;
+}
+
+export interface TeamScore {
+  members: string[];
+  tiles: number;
+  resources: number;
+}
+
+export interface Winner {
+  team?: string;
+  playerIds: string[];
+  reason: 'territory' | 'resources';
+  tick: number;
+}
+
+// SnapshotDelta is the change from one tick to the next, sent when a client
+// resumes its session.
+export interface SnapshotDelta {
+  fromTick: number;
+  tick: number;
+  tiles?: Tile[];
+  players?: Record<string, Player>;
+  removedPlayers?: string[];
+  resources: Resource[];
+  teams?: Record<string, TeamScore>;
+  winner?: Winner;
+  agreements?: Agreement[];
+}
+
+export type ChatChannel = 'global' | 'team' | 'direct';
+
+export interface ChatMessage {
+  id: string;
+  channel: ChatChannel;
+  from: string;
+  fromName?: string;
+  to?: string;
+  team?: string;
+  text: string;
+  sentAt: string;
+  deleted?: boolean;
+}
+
+export type PingKind = 'attack' | 'defend' | 'resource';
+
+// MapPing is a short-lived ping a player sent to their side.
+export interface MapPing {
+  id: string;
+  playerId: string;
+  team?: string;
+  kind: PingKind;
+  position: Position;
+  createdAt: string;
+  expiresAt: string;
+}
+
+// MapMarker is a note a player left on the map for themselves.
+export interface MapMarker {
+  id: string;
+  playerId: string;
+  position: Position;
+  label?: string;
+  createdAt: string;
+}
+
+// AllianceRequest asks the recipient to join the sender's team.
+export interface AllianceRequest {
+  from: string;
+  to: string;
+  expiresAt: string;
+}
+
+// AgreementProposal offers the recipient an agreement lasting ticks.
+export interface AgreementProposal {
+  from: string;
+  to: string;
+  kind: Agreement['kind'];
+  ticks: number;
+  expiresAt: string;
 }
@@ -85,10 +85,10 @@ fi
 
 if [ "$MODE" = "production" ]; then
   sed -i "s/^TLS_ONLY=.*/TLS_ONLY=true/" .env
-  sed -i "s/^ALLOW_INSECURE_AUTH=.*/ALLOW_INSECURE_AUTH=false/" .env
+  sed -i "s/^AUTH_DEV_ISSUER=.*/AUTH_DEV_ISSUER=false/" .env
 else
   sed -i "s/^TLS_ONLY=.*/TLS_ONLY=false/" .env
-  sed -i "s/^ALLOW_INSECURE_AUTH=.*/ALLOW_INSECURE_AUTH=true/" .env
+  sed -i "s/^AUTH_DEV_ISSUER=.*/AUTH_DEV_ISSUER=true/" .env
 fi
 
 sed "s/__DOMAIN__/$DOMAIN/g" nginx/default.conf.template > nginx/default.conf
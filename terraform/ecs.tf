@@ -29,6 +29,49 @@ resource "aws_cloudwatch_log_group" "frontend" {
   tags = local.common_tags
 }
 
+# The backend keeps bans, profiles, checkpoints and replays in a file store.
+# Task storage is lost when a task stops, so it lives on EFS instead.
+resource "aws_efs_file_system" "backend" {
+  count = local.enable_ecs ? 1 : 0
+
+  creation_token = "${local.project_name}-backend-data"
+  encrypted      = true
+
+  tags = merge(local.common_tags, { Name = "${local.project_name}-backend-data" })
+}
+
+resource "aws_efs_mount_target" "backend" {
+  count = local.enable_ecs ? length(module.vpc.public_subnets) : 0
+
+  file_system_id  = aws_efs_file_system.backend[0].id
+  subnet_id       = module.vpc.public_subnets[count.index]
+  security_groups = [aws_security_group.efs[0].id]
+}
+
+# The backend image runs as the distroless nonroot user (65532), which owns
+# the directory the access point creates.
+resource "aws_efs_access_point" "backend" {
+  count = local.enable_ecs ? 1 : 0
+
+  file_system_id = aws_efs_file_system.backend[0].id
+
+  posix_user {
+    uid = 65532
+    gid = 65532
+  }
+
+  root_directory {
+    path = "/backend"
+    creation_info {
+      owner_uid   = 65532
+      owner_gid   = 65532
+      permissions = "0750"
+    }
+  }
+
+  tags = local.common_tags
+}
+
 resource "aws_iam_role" "ecs_execution" {
   count = local.enable_ecs ? 1 : 0
 
@@ -109,7 +152,16 @@ resource "aws_ecs_task_definition" "backend" {
         { name = "COGNITO_REGION", value = var.aws_region },
         { name = "COGNITO_USER_POOL_ID", value = aws_cognito_user_pool.main.id },
         { name = "COGNITO_APP_CLIENT_ID", value = aws_cognito_user_pool_client.main.id },
-        { name = "CORS_ALLOWED_ORIGIN", value = "*" }
+        { name = "CORS_ALLOWED_ORIGIN", value = "*" },
+        { name = "STORAGE_BACKEND", value = "file" },
+        { name = "STORAGE_DIR", value = "/app/data" }
+      ]
+      mountPoints = [
+        {
+          sourceVolume  = "backend-data"
+          containerPath = "/app/data"
+          readOnly      = false
+        }
       ]
       logConfiguration = {
         logDriver = "awslogs"
@@ -122,6 +174,19 @@ resource "aws_ecs_task_definition" "backend" {
     }
   ])
 
+  volume {
+    name = "backend-data"
+
+    efs_volume_configuration {
+      file_system_id     = aws_efs_file_system.backend[0].id
+      transit_encryption = "ENABLED"
+
+      authorization_config {
+        access_point_id = aws_efs_access_point.backend[0].id
+      }
+    }
+  }
+
   tags = local.common_tags
 }
 
@@ -183,7 +248,7 @@ resource "aws_ecs_service" "backend" {
     container_port   = 8080
   }
 
-  depends_on = [aws_lb_listener.backend]
+  depends_on = [aws_lb_listener.backend, aws_efs_mount_target.backend]
 }
 
 resource "aws_ecs_service" "frontend" {
@@ -113,6 +113,24 @@ resource "aws_security_group" "tasks" {
   tags = local.common_tags
 }
 
+resource "aws_security_group" "efs" {
+  count = local.enable_ecs ? 1 : 0
+
+  name        = "${local.project_name}-efs"
+  description = "Backend storage security group"
+  vpc_id      = module.vpc.vpc_id
+
+  ingress {
+    description     = "NFS from tasks"
+    from_port       = 2049
+    to_port         = 2049
+    protocol        = "tcp"
+    security_groups = [aws_security_group.tasks[0].id]
+  }
+
+  tags = local.common_tags
+}
+
 resource "aws_lb" "main" {
   count              = local.enable_ecs ? 1 : 0
   name               = "${local.project_name}-alb"